@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+)
+
+// Scopes that can be granted to api keys
+const (
+	ScopeCreate   = "create"    // Create short urls
+	ScopeReadInfo = "read-info" // Read the info of short urls
+	ScopeManage   = "manage"    // Update, delete and export the analytics of owned short urls
+	ScopeAdmin    = "admin"     // Everything in its workspace, including issuing and revoking api keys
+)
+
+var Scopes = []string{ScopeCreate, ScopeReadInfo, ScopeManage, ScopeAdmin}
+
+// Principal is the authenticated client of a request
+type Principal struct {
+	ID        string // Unique across kinds, e.g. apikey:<id> or user:<subject>
+	Name      string
+	Groups    []string // Groups of users from their identity provider
+	Scopes    []string
+	Workspace string // Empty for principals outside workspaces, e.g. the admin key of the configuration
+
+	// Quotas of the short urls created by the principal, 0 means unlimited
+	MaxLinks       int64
+	MaxLinksPerDay int64
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Global admins manage every workspace, admins of a workspace only their own
+func (p *Principal) IsGlobalAdmin() bool {
+	return p.Workspace == "" && p.HasScope(ScopeAdmin)
+}
+
+// Checks if the principal can see the resources of a workspace.
+// Resources outside workspaces belong to no tenant and are not restricted.
+func (p *Principal) InWorkspace(workspace string) bool {
+	return workspace == "" || p.Workspace == workspace || p.IsGlobalAdmin()
+}
+
+// Checks if the principal is an admin of the workspace, resources outside workspaces are only administered by global admins
+func (p *Principal) AdminOf(workspace string) bool {
+	return p.HasScope(ScopeAdmin) && (p.Workspace == "" || p.Workspace == workspace)
+}
+
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// Returns a copy of ctx carrying the authenticated principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// Returns the principal of the request, nil for anonymous requests
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
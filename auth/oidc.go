@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"ilmavridis/url-shortener/config"
+
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Scopes of users authenticated with a JWT, users in the admin groups also get the admin scope
+var userScopes = []string{ScopeCreate, ScopeReadInfo, ScopeManage}
+
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+var (
+	verifierOnce sync.Once
+	verifier     *keySetVerifier
+	verifierErr  error
+)
+
+type keySetVerifier struct {
+	keys *KeySet
+	conf config.Config
+}
+
+// InitOIDC loads the JWKS of the identity provider, if JWT authentication is enabled
+func InitOIDC() error {
+	verifierOnce.Do(func() {
+		conf := config.Get()
+		if !conf.Auth.OIDC.Enabled {
+			return
+		}
+
+		keys, err := NewKeySet(conf.Auth.OIDC.JwksUrl, conf.Auth.OIDC.JwksFile)
+		if err != nil {
+			verifierErr = fmt.Errorf("loading jwks: %v", err)
+			return
+		}
+		verifier = &keySetVerifier{keys: keys, conf: conf}
+	})
+
+	return verifierErr
+}
+
+func OIDCEnabled() bool {
+	InitOIDC()
+	return verifier != nil
+}
+
+// VerifyJWT validates the signature and the claims of a JWT issued by the identity provider
+// and returns the user it identifies
+func VerifyJWT(tokenString string) (*Principal, error) {
+	if err := InitOIDC(); err != nil {
+		return nil, err
+	}
+	if verifier == nil {
+		return nil, errors.New("jwt authentication is disabled")
+	}
+	oidc := verifier.conf.Auth.OIDC
+
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(signingMethods))
+	_, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return verifier.keys.Key(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) {
+		return nil, errors.New("token has no expiration or is expired")
+	}
+	if oidc.Issuer != "" && !claims.VerifyIssuer(oidc.Issuer, true) {
+		return nil, errors.New("wrong token issuer")
+	}
+	if oidc.Audience != "" && !claims.VerifyAudience(oidc.Audience, true) {
+		return nil, errors.New("wrong token audience")
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	name, _ := claims[oidc.UserClaim].(string)
+	if name == "" {
+		name = subject
+	}
+
+	principal := &Principal{
+		ID:     "user:" + subject,
+		Name:   name,
+		Groups: stringsClaim(claims[oidc.GroupsClaim]),
+		Scopes: userScopes,
+
+		MaxLinks:       verifier.conf.Quotas.Users.MaxLinks,
+		MaxLinksPerDay: verifier.conf.Quotas.Users.MaxLinksPerDay,
+	}
+	if oidc.WorkspaceClaim != "" {
+		principal.Workspace, _ = claims[oidc.WorkspaceClaim].(string)
+	}
+	for _, group := range principal.Groups {
+		if contains(oidc.AdminGroups, group) {
+			principal.Scopes = append([]string{ScopeAdmin}, userScopes...)
+			break
+		}
+	}
+
+	return principal, nil
+}
+
+// Accepts a list of strings or a single space separated string, both are used for groups by providers
+func stringsClaim(claim interface{}) []string {
+	switch value := claim.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case string:
+		return strings.Fields(value)
+	default:
+		return nil
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Tokens with two dots are JWTs, api keys have their own prefix
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && !IsAPIKey(token)
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"ilmavridis/url-shortener/auth"
 	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/events"
+	"ilmavridis/url-shortener/geoip"
 	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/policy"
+	"ilmavridis/url-shortener/preview"
 	"ilmavridis/url-shortener/redisStorage"
 	"ilmavridis/url-shortener/routes"
+	"ilmavridis/url-shortener/scanner"
+	"ilmavridis/url-shortener/tracing"
 
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -34,32 +42,80 @@ func main() {
 		zap.Duration("idle timeout", conf.Server.TimeoutIdle),
 	)
 
+	err = tracing.Init()
+	if err != nil {
+		logger.Fatal("Could not set up tracing: ", err)
+	}
+
 	err = redisStorage.CreateClient()
 	if err != nil {
 		logger.Fatal("Could not connect to redis: ", err)
 	}
-	redisClient := redisStorage.Get()
-	defer redisClient.Close()
+	defer redisStorage.Close()
 	logger.Info("Connected to redis", zap.String("address", conf.Redis.Address))
 
+	err = auth.InitOIDC()
+	if err != nil {
+		logger.Fatal("Could not set up JWT authentication: ", err)
+	}
+
+	err = policy.Init()
+	if err != nil {
+		logger.Fatal("Could not load url policy: ", err)
+	}
+
+	err = events.Init()
+	if err != nil {
+		logger.Fatal("Could not create click event publisher: ", err)
+	}
+	defer events.Close()
+
+	err = scanner.Init()
+	if err != nil {
+		logger.Fatal("Could not set up url scanning: ", err)
+	}
+	scanCtx, stopScanning := context.WithCancel(context.Background())
+	defer stopScanning()
+	if conf.Scanner.Interval > 0 {
+		go scanner.RunPeriodic(scanCtx, conf.Scanner.Interval)
+	}
+
+	previewCtx, stopPreviews := context.WithCancel(context.Background())
+	defer stopPreviews()
+	if conf.Preview.Interval > 0 {
+		go preview.RunPeriodic(previewCtx, conf.Preview.Interval)
+	}
+
+	err = geoip.Init()
+	if err != nil {
+		logger.Fatal("Could not open GeoIP database: ", err)
+	}
+	defer geoip.Close()
+
 	srv := routes.New()
 	errs := routes.Run(srv)
 	logger.Info("Server start running, listening at ", zap.String("address", srv.Addr))
 
 	// Graceful shutdown when recieving SIGINT / Ctrl+C
 	// SIGKILL, SIGQUIT or SIGTERM will not be caught
-	stopChan := make(chan os.Signal)
+	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, os.Interrupt)
 	select {
 	case err := <-errs:
 		logger.Error("Error starting server: ", err)
 	case sig := <-stopChan:
 		logger.Info("Signal received, shutting down server...", zap.String("signal", sig.String()))
+		stopScanning()
+		stopPreviews()
 		if err := routes.SetupGracefulShutdown(srv); err != nil {
 			logger.Error("Server shutdown error: ", err)
 		}
+		// Exports the spans of the last requests
+		if err := tracing.Shutdown(context.Background()); err != nil {
+			logger.Error("Tracing shutdown error: ", err)
+		}
+		// Returning runs the deferred closes of the click event publisher, redis and the GeoIP database
 		logger.Info("Server gracefully stopped!")
-		os.Exit(0)
 	}
 
 }
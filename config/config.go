@@ -4,6 +4,8 @@ import (
 	"ilmavridis/url-shortener/logger"
 
 	"flag"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"time"
@@ -13,10 +15,11 @@ import (
 )
 
 type server struct {
-	Address      string        `mapstructure:"address"`
-	TimeoutWrite time.Duration `mapstructure:"timeoutWrite"`
-	TimeoutRead  time.Duration `mapstructure:"timeoutRead"`
-	TimeoutIdle  time.Duration `mapstructure:"timeoutIdle"`
+	Address        string        `mapstructure:"address"`
+	TimeoutWrite   time.Duration `mapstructure:"timeoutWrite"`
+	TimeoutRead    time.Duration `mapstructure:"timeoutRead"`
+	TimeoutIdle    time.Duration `mapstructure:"timeoutIdle"`
+	TrustedProxies []string      `mapstructure:"trustedProxies"` // IPs or CIDRs of proxies whose X-Forwarded-For header is trusted
 }
 
 type redis struct {
@@ -26,10 +29,169 @@ type redis struct {
 	Expiry   time.Duration `mapstructure:"expiry"`
 }
 
+type events struct {
+	Publisher string `mapstructure:"publisher"` // Name of the click event publisher, empty disables publishing
+	Stream    string `mapstructure:"stream"`
+	MaxLen    int64  `mapstructure:"maxLen"`
+}
+
+type stats struct {
+	MaxClicks int64 `mapstructure:"maxClicks"` // Clicks kept per short url for analytics exports
+}
+
+type metrics struct {
+	Enabled bool `mapstructure:"enabled"` // Exposes prometheus metrics on /metrics
+}
+
+type tracing struct {
+	Exporter    string  `mapstructure:"exporter"` // "otlp", "stdout" or empty to disable tracing
+	Endpoint    string  `mapstructure:"endpoint"` // host:port of the OTLP/HTTP collector
+	Insecure    bool    `mapstructure:"insecure"`
+	ServiceName string  `mapstructure:"serviceName"`
+	SampleRatio float64 `mapstructure:"sampleRatio"`
+}
+
+// Token bucket: a client can send burst requests at once, refilled at requestsPerMinute
+type rateLimitPolicy struct {
+	RequestsPerMinute float64 `mapstructure:"requestsPerMinute"`
+	Burst             int64   `mapstructure:"burst"`
+}
+
+type rateLimit struct {
+	Enabled bool            `mapstructure:"enabled"`
+	Shorten rateLimitPolicy `mapstructure:"shorten"`
+	Resolve rateLimitPolicy `mapstructure:"resolve"`
+}
+
+type oidc struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	Issuer         string   `mapstructure:"issuer"`
+	Audience       string   `mapstructure:"audience"`
+	JwksUrl        string   `mapstructure:"jwksUrl"`
+	JwksFile       string   `mapstructure:"jwksFile"` // Used instead of jwksUrl, e.g. for offline testing
+	UserClaim      string   `mapstructure:"userClaim"`
+	GroupsClaim    string   `mapstructure:"groupsClaim"`
+	AdminGroups    []string `mapstructure:"adminGroups"`
+	WorkspaceClaim string   `mapstructure:"workspaceClaim"` // Claim with the workspace of the user
+}
+
+type auth struct {
+	Required bool   `mapstructure:"required"` // Anonymous clients can't create short urls or read their info
+	AdminKey string `mapstructure:"adminKey"` // Api key with the admin scope, used to issue the first api keys
+	OIDC     oidc   `mapstructure:"oidc"`
+}
+
+type quota struct {
+	MaxLinks       int64 `mapstructure:"maxLinks"`       // Active short urls, 0 means unlimited
+	MaxLinksPerDay int64 `mapstructure:"maxLinksPerDay"` // Short urls created per day (UTC), 0 means unlimited
+}
+
+type quotas struct {
+	Users quota `mapstructure:"users"` // Quota of every user authenticated with a JWT
+}
+
+type policyRules struct {
+	Domains []string `mapstructure:"domains"` // Matches the domain and its subdomains
+	Regexes []string `mapstructure:"regexes"` // Matches the whole url
+	CIDRs   []string `mapstructure:"cidrs"`   // Matches urls with an IP address in the range as host
+}
+
+type policy struct {
+	DefaultAction string      `mapstructure:"defaultAction"` // "allow" or "block" urls that match no rule
+	File          string      `mapstructure:"file"`          // YAML file with more rules, reloaded when it changes
+	Allow         policyRules `mapstructure:"allow"`         // Exceptions to the block rules
+	Block         policyRules `mapstructure:"block"`
+
+	Schemes        []string      `mapstructure:"schemes"`        // Schemes of the urls that can be shortened
+	AllowInternal  []string      `mapstructure:"allowInternal"`  // CIDRs of loopback, link-local or private addresses that destinations may resolve to
+	ResolveTimeout time.Duration `mapstructure:"resolveTimeout"` // Time to resolve the host of a url
+}
+
+type safeBrowsing struct {
+	APIKey   string `mapstructure:"apiKey"`
+	Endpoint string `mapstructure:"endpoint"`
+	ClientID string `mapstructure:"clientId"`
+}
+
+type hashList struct {
+	File string `mapstructure:"file"` // Hex SHA256 hashes of malicious url expressions, one per line
+}
+
+type scanner struct {
+	Checkers     []string      `mapstructure:"checkers"` // "safebrowsing" and "hashlist", empty disables scanning
+	Interval     time.Duration `mapstructure:"interval"` // Existing short urls are scanned again this often, 0 disables it
+	SafeBrowsing safeBrowsing  `mapstructure:"safeBrowsing"`
+	HashList     hashList      `mapstructure:"hashList"`
+}
+
+type passwords struct {
+	MaxAttempts int64         `mapstructure:"maxAttempts"` // Wrong passwords before a short url is locked
+	Lockout     time.Duration `mapstructure:"lockout"`     // How long a short url stays locked
+	Cost        int           `mapstructure:"cost"`        // Bcrypt cost of the password hashes
+}
+
+type activation struct {
+	PendingUrl string `mapstructure:"pendingUrl"` // Short urls redirect here before they are active, instead of showing the not yet active page
+}
+
+type fallbackDomain struct {
+	Domain string `mapstructure:"domain"`
+	Url    string `mapstructure:"url"`
+}
+
+type fallback struct {
+	DefaultUrl string           `mapstructure:"defaultUrl"` // For unknown short urls and short urls without another fallback
+	Domains    []fallbackDomain `mapstructure:"domains"`    // For short urls requested on one of the domains
+	Retention  time.Duration    `mapstructure:"retention"`  // How long the fallback url of a short url is kept after it expires
+}
+
+// Fallback urls are redirected to without the checks of a destination, so they must at least be web urls
+func (f fallback) validate() error {
+	urls := []string{f.DefaultUrl}
+	for _, domain := range f.Domains {
+		urls = append(urls, domain.Url)
+	}
+
+	for _, fallbackUrl := range urls {
+		if fallbackUrl == "" {
+			continue
+		}
+		u, err := url.Parse(fallbackUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid fallback url %q, it must be an absolute http or https url", fallbackUrl)
+		}
+	}
+	return nil
+}
+
+type geoIP struct {
+	Database string `mapstructure:"database"` // MaxMind mmdb file with the countries of IP addresses
+}
+
+type preview struct {
+	Interval time.Duration `mapstructure:"interval"` // How often queued destinations are fetched, 0 disables it
+	Timeout  time.Duration `mapstructure:"timeout"`  // Time to fetch a page or a favicon
+	MaxAge   time.Duration `mapstructure:"maxAge"`   // Previews older than this are fetched again
+}
+
 // Config holds all service configs
 type Config struct {
-	Server server
-	Redis  redis
+	Server     server
+	Redis      redis
+	Events     events
+	Stats      stats
+	Metrics    metrics
+	Tracing    tracing
+	Auth       auth
+	RateLimit  rateLimit
+	Quotas     quotas
+	Policy     policy
+	Scanner    scanner
+	Passwords  passwords
+	Activation activation
+	Fallback   fallback
+	GeoIP      geoIP
+	Preview    preview
 }
 
 var configs Config
@@ -69,7 +231,7 @@ func Read() error {
 	}
 
 	v.Unmarshal(&configs)
-	return nil
+	return configs.Fallback.validate()
 
 }
 
@@ -0,0 +1,96 @@
+package events
+
+import (
+	"ilmavridis/url-shortener/config"
+
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ClickEvent is emitted every time a short url is resolved
+type ClickEvent struct {
+	ShortUrl  string
+	Url       string
+	Timestamp time.Time
+	RemoteIP  string
+	UserAgent string
+	Referer   string
+	Variant   string
+}
+
+// Publisher exports click events to a message broker.
+// Adapters for other brokers (NATS, Kafka...) implement it and register a Factory.
+type Publisher interface {
+	Publish(ctx context.Context, event ClickEvent) error
+	Close() error
+}
+
+// Factory creates a Publisher from the service configuration
+type Factory func(conf config.Config) (Publisher, error)
+
+var (
+	mu        sync.RWMutex
+	factories           = map[string]Factory{}
+	publisher Publisher = noopPublisher{}
+)
+
+// Register makes a publisher available by name to the events.publisher configuration
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[name] = factory
+}
+
+// Init creates the publisher selected in the configuration.
+// If no publisher is configured, events are discarded.
+func Init() error {
+	conf := config.Get()
+	name := conf.Events.Publisher
+	if name == "" {
+		return nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	factory, ok := factories[name]
+	if !ok {
+		return fmt.Errorf("unknown event publisher %q", name)
+	}
+
+	p, err := factory(conf)
+	if err != nil {
+		return err
+	}
+	publisher = p
+
+	return nil
+}
+
+// Returns the publisher created by Init
+func Get() Publisher {
+	mu.RLock()
+	defer mu.RUnlock()
+	return publisher
+}
+
+// Close closes the active publisher and falls back to discarding events
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	err := publisher.Close()
+	publisher = noopPublisher{}
+	return err
+}
+
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(ctx context.Context, event ClickEvent) error {
+	return nil
+}
+
+func (noopPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func init() {
+	Register("redis", NewRedisStreamPublisher)
+}
+
+// RedisStreamPublisher appends every click event to a Redis Stream (XADD).
+// The stream is trimmed to approximately MaxLen entries.
+type RedisStreamPublisher struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+func NewRedisStreamPublisher(conf config.Config) (Publisher, error) {
+	client, err := redisStorage.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedisStreamPublisher{
+		client: client,
+		stream: conf.Events.Stream,
+		maxLen: conf.Events.MaxLen,
+	}, nil
+}
+
+func (p *RedisStreamPublisher) Publish(ctx context.Context, event ClickEvent) error {
+	return p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.stream,
+		MaxLen: p.maxLen,
+		Approx: true, // Trimming with ~ is much cheaper for redis
+		Values: map[string]interface{}{
+			"short":      event.ShortUrl,
+			"url":        event.Url,
+			"timestamp":  event.Timestamp.UTC().Format(time.RFC3339Nano),
+			"remote_ip":  event.RemoteIP,
+			"user_agent": event.UserAgent,
+			"referer":    event.Referer,
+			"variant":    event.Variant,
+		},
+	}).Err()
+}
+
+func (p *RedisStreamPublisher) Close() error {
+	return p.client.Close()
+}
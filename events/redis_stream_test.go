@@ -0,0 +1,56 @@
+package events
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"testing"
+	"time"
+)
+
+func TestRedisStreamPublisher(t *testing.T) {
+	config.Read()
+	conf := config.Get()
+
+	publisher, err := NewRedisStreamPublisher(conf)
+	if err != nil {
+		t.Errorf("Error at creating redis stream publisher: %v", err)
+		return
+	}
+	defer publisher.Close()
+
+	redisClient, err := redisStorage.NewClient()
+	if err != nil {
+		t.Errorf("Error at creating redis client: %v", err)
+		return
+	}
+	defer redisClient.Close()
+	defer redisClient.Del(redisStorage.Ctx, conf.Events.Stream)
+
+	event := ClickEvent{
+		ShortUrl:  "short0",
+		Url:       "http://www.testsite1.com",
+		Timestamp: time.Now(),
+		RemoteIP:  "10.0.0.1",
+		UserAgent: "test-agent",
+	}
+
+	if err := publisher.Publish(redisStorage.Ctx, event); err != nil {
+		t.Errorf("Error at publishing click event: %v", err)
+	}
+
+	messages, err := redisClient.XRange(redisStorage.Ctx, conf.Events.Stream, "-", "+").Result()
+	if err != nil {
+		t.Errorf("Error at reading redis stream: %v", err)
+		return
+	}
+
+	if len(messages) != 1 {
+		t.Errorf("Error: Wrong number of stream entries: got %v want %v", len(messages), 1)
+		return
+	}
+
+	if messages[0].Values["short"] != event.ShortUrl || messages[0].Values["url"] != event.Url {
+		t.Errorf("Error: Wrong stream entry: got %v", messages[0].Values)
+	}
+}
@@ -0,0 +1,101 @@
+package geoip
+
+import (
+	"ilmavridis/url-shortener/config"
+
+	"io"
+	"net"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Locator looks up the country of an IP address
+type Locator interface {
+	// Returns the ISO 3166-1 alpha-2 code of the country (e.g. US), empty if it is unknown
+	Country(ip net.IP) (string, error)
+}
+
+var (
+	mu      sync.RWMutex
+	locator Locator = noLocator{}
+)
+
+// Init opens the GeoIP database of the configuration.
+// Without one the country of every address is unknown.
+func Init() error {
+	conf := config.Get()
+
+	if conf.GeoIP.Database == "" {
+		Set(noLocator{})
+		return nil
+	}
+
+	reader, err := maxminddb.Open(conf.GeoIP.Database)
+	if err != nil {
+		return err
+	}
+	Set(&mmdbLocator{reader: reader})
+
+	return nil
+}
+
+// Sets the locator of country rules, e.g. a static one for tests
+func Set(l Locator) {
+	mu.Lock()
+	defer mu.Unlock()
+	locator = l
+}
+
+// Returns the locator created by Init
+func Get() Locator {
+	mu.RLock()
+	defer mu.RUnlock()
+	return locator
+}
+
+// Closes the GeoIP database
+func Close() error {
+	if closer, ok := Get().(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// noLocator is used when no GeoIP database is configured
+type noLocator struct{}
+
+func (noLocator) Country(ip net.IP) (string, error) {
+	return "", nil
+}
+
+// mmdbLocator looks up addresses in a MaxMind database, either a country or a city one
+type mmdbLocator struct {
+	reader *maxminddb.Reader
+}
+
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	// Where the network is registered, for addresses without a country
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+func (l *mmdbLocator) Country(ip net.IP) (string, error) {
+	var record mmdbRecord
+	if err := l.reader.Lookup(ip, &record); err != nil {
+		return "", err
+	}
+
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode, nil
+	}
+	return record.RegisteredCountry.ISOCode, nil
+}
+
+func (l *mmdbLocator) Close() error {
+	return l.reader.Close()
+}
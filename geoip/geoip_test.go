@@ -0,0 +1,51 @@
+package geoip
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"net"
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+func TestInitWithoutDatabase(t *testing.T) {
+	logger.New()
+	config.Read()
+	if err := Init(); err != nil {
+		t.Fatalf("Error at opening GeoIP database: %v", err)
+	}
+	defer Close()
+
+	country, err := Get().Country(net.ParseIP("81.2.69.142"))
+	if err != nil || country != "" {
+		t.Errorf("Error: Wrong country without a GeoIP database: got %q (%v)", country, err)
+	}
+}
+
+// testdata/test-country.mmdb has the networks 81.2.69.0/24 in GB, 89.160.20.0/24 in SE
+// and 2.125.160.0/24 without a country, registered in DE
+func TestMmdbLocator(t *testing.T) {
+	reader, err := maxminddb.Open("testdata/test-country.mmdb")
+	if err != nil {
+		t.Fatalf("Error at opening GeoIP database: %v", err)
+	}
+	l := &mmdbLocator{reader: reader}
+	defer l.Close()
+
+	tests := map[string]string{
+		"81.2.69.142":      "GB",
+		"89.160.20.1":      "SE",
+		"::ffff:81.2.69.1": "GB",
+		// Addresses without a country are located where their network is registered
+		"2.125.160.216": "DE",
+		"8.8.8.8":       "",
+	}
+	for ip, want := range tests {
+		country, err := l.Country(net.ParseIP(ip))
+		if err != nil || country != want {
+			t.Errorf("Error: Wrong country of %s: got %q (%v) want %q", ip, country, err, want)
+		}
+	}
+}
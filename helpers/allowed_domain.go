@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Parses a url, assuming http for urls without a scheme
+func ParseURL(rawUrl string) (*url.URL, error) {
+	// Urls without a scheme are accepted by the validator, e.g. www.example.com
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "http://" + rawUrl
+	}
+	return url.Parse(rawUrl)
+}
+
+// Returns the lowercase host of a url, without the port and the trailing dot
+func Hostname(u *url.URL) string {
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// Checks if the host is the domain or one of its subdomains
+func MatchDomain(host string, domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// Checks if the host of the url is one of the domains or one of their subdomains.
+// An empty list of domains allows every url.
+func DomainAllowed(rawUrl string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+
+	u, err := ParseURL(rawUrl)
+	if err != nil {
+		return false
+	}
+	host := Hostname(u)
+
+	for _, domain := range domains {
+		if MatchDomain(host, domain) {
+			return true
+		}
+	}
+
+	return false
+}
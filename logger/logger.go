@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"time"
 
 	"go.uber.org/zap"
@@ -22,6 +23,23 @@ func Get() zap.Logger {
 	return zapLog
 }
 
+type fieldsKey struct{}
+
+// Returns a copy of ctx carrying fields that are added to every line logged through FromContext
+func WithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	existing, _ := ctx.Value(fieldsKey{}).([]zap.Field)
+	all := make([]zap.Field, 0, len(existing)+len(fields))
+	all = append(all, existing...)
+	all = append(all, fields...)
+	return context.WithValue(ctx, fieldsKey{}, all)
+}
+
+// Returns a logger with the fields of the request that ctx belongs to
+func FromContext(ctx context.Context) *zap.Logger {
+	fields, _ := ctx.Value(fieldsKey{}).([]zap.Field)
+	return zapLog.With(fields...)
+}
+
 func Info(message string, fields ...zap.Field) {
 	zapLog.Info(message, fields...)
 }
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// All metrics are registered to the default prometheus registry,
+// which also exports the Go runtime and process metrics.
+var (
+	HttpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by route, method and status class.",
+	}, []string{"route", "method", "status"})
+
+	HttpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route, method and status class.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	RedisDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "redis_command_duration_seconds",
+		Help:    "Latency of redis commands.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"command"})
+
+	RedisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "redis_command_errors_total",
+		Help: "Number of failed redis commands.",
+	}, []string{"command"})
+
+	Shortened = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "shortener_shortened_total",
+		Help: "Number of short urls created.",
+	})
+
+	Resolved = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "shortener_resolved_total",
+		Help: "Number of short urls resolved to their long url.",
+	})
+
+	NotFound = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "shortener_not_found_total",
+		Help: "Number of requests for short urls that do not exist.",
+	})
+)
+
+// Groups status codes to keep the number of series low, e.g. 404 -> "4xx"
+func StatusClass(status int) string {
+	switch {
+	case status >= 500:
+		return "5xx"
+	case status >= 400:
+		return "4xx"
+	case status >= 300:
+		return "3xx"
+	case status >= 200:
+		return "2xx"
+	default:
+		return "1xx"
+	}
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"ilmavridis/url-shortener/auth"
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// It authenticates the api key sent in the X-API-Key header or as an Authorization bearer token,
+// or the JWT of a user sent as a bearer token.
+// Requests without credentials continue anonymously, RequireScope decides if that is allowed.
+func Auth(h http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		token := credentials(r)
+		if token == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		var principal *auth.Principal
+		var status int
+		var message string
+		if auth.IsJWT(token) && auth.OIDCEnabled() {
+			principal, status, message = authenticateJWT(r, token)
+		} else {
+			principal, status, message = authenticateAPIKey(w, r, token)
+		}
+		if principal == nil {
+			// The response is already written if the status is 0
+			if status != 0 {
+				JSONError(w, r, status, message)
+			}
+			return
+		}
+
+		ctx := auth.WithPrincipal(r.Context(), principal)
+		ctx = logger.WithFields(ctx, zap.String("principal", principal.ID), zap.String("principal_name", principal.Name))
+		if principal.Workspace != "" {
+			ctx = logger.WithFields(ctx, zap.String("workspace", principal.Workspace))
+		}
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// It rejects requests whose principal lacks the scope.
+// Anonymous requests can create short urls and read their info unless auth.required is set.
+// Management endpoints also accept the owner token of the short url, which the handlers check.
+func RequireScope(scope string, h http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		principal := auth.FromContext(r.Context())
+		if principal == nil {
+			if !anonymousAllowed(scope) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="url-shortener"`)
+				JSONError(w, r, http.StatusUnauthorized, "authentication required")
+				return
+			}
+		} else if !principal.HasScope(scope) {
+			JSONError(w, r, http.StatusForbidden, fmt.Sprintf("api key is missing the %s scope", scope))
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func anonymousAllowed(scope string) bool {
+	switch scope {
+	case auth.ScopeManage:
+		return true
+	case auth.ScopeCreate, auth.ScopeReadInfo:
+		return !config.Get().Auth.Required
+	default:
+		return false
+	}
+}
+
+func credentials(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+
+	return ""
+}
+
+// Returns the user of the JWT, or the status and message of the error response
+func authenticateJWT(r *http.Request, token string) (*auth.Principal, int, string) {
+	principal, err := auth.VerifyJWT(token)
+	if err != nil {
+		logger.FromContext(r.Context()).Info("Invalid JWT", zap.Error(err))
+		return nil, http.StatusUnauthorized, "invalid token"
+	}
+	return principal, 0, ""
+}
+
+// Returns the principal of the api key, or the status and message of the error response.
+// Rate limited requests get their response here and a status of 0.
+func authenticateAPIKey(w http.ResponseWriter, r *http.Request, key string) (*auth.Principal, int, string) {
+	conf := config.Get()
+
+	// The admin key of the configuration bootstraps issuing the first api keys
+	if conf.Auth.AdminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(conf.Auth.AdminKey)) == 1 {
+		return &auth.Principal{ID: "admin", Name: "admin", Scopes: []string{auth.ScopeAdmin}}, 0, ""
+	}
+
+	apiKey, found, err := redisStorage.GetAPIKey(r.Context(), auth.HashToken(key))
+	if err != nil {
+		return nil, http.StatusInternalServerError, "conntecting to redis"
+	}
+	if !found {
+		return nil, http.StatusUnauthorized, "invalid api key"
+	}
+
+	// The rate limit of the key is a token bucket that allows the requests of a minute at once
+	if apiKey.RateLimit > 0 {
+		result, err := redisStorage.TakeToken(r.Context(), "apikey:"+apiKey.ID, float64(apiKey.RateLimit), apiKey.RateLimit)
+		if err != nil {
+			return nil, http.StatusInternalServerError, "conntecting to redis"
+		}
+		if !allow(w, r, result, "api key rate limit exceeded") {
+			return nil, 0, ""
+		}
+	}
+
+	return &auth.Principal{
+		ID:        auth.APIKeyPrincipalID(apiKey.ID),
+		Name:      apiKey.Name,
+		Scopes:    apiKey.Scopes,
+		Workspace: apiKey.Workspace,
+
+		MaxLinks:       apiKey.MaxLinks,
+		MaxLinksPerDay: apiKey.MaxLinksPerDay,
+	}, 0, ""
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Returns the json body of an error response.
+// The request id is included so that clients can report it.
+func ErrorBody(r *http.Request, message string) []byte {
+	return ErrorBodyWith(r, message, nil)
+}
+
+// Returns the json body of an error response with further fields describing the error
+func ErrorBodyWith(r *http.Request, message string, fields map[string]interface{}) []byte {
+	body := map[string]interface{}{"error": message}
+	for name, value := range fields {
+		body[name] = value
+	}
+	if requestID := GetRequestID(r.Context()); requestID != "" {
+		body["request_id"] = requestID
+	}
+
+	jsonResp, _ := json.Marshal(body)
+	return jsonResp
+}
+
+// Writes an error response with the message encoded in json
+func JSONError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	http.Error(w, http.StatusText(status), status)
+	w.Write(ErrorBody(r, message))
+}
+
+// Writes an error response with the message and further fields encoded in json
+func JSONErrorWith(w http.ResponseWriter, r *http.Request, status int, message string, fields map[string]interface{}) {
+	http.Error(w, http.StatusText(status), status)
+	w.Write(ErrorBodyWith(r, message, fields))
+}
@@ -2,10 +2,17 @@ package middleware
 
 import (
 	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/metrics"
+	"ilmavridis/url-shortener/tracing"
 
 	"net/http"
 	"time"
 
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -28,23 +35,109 @@ func Logger(h http.HandlerFunc) http.HandlerFunc {
 		status := zap.Int("status", recorder.Status)
 		duration := zap.Duration("duration", time.Duration(time.Since(startTime)))
 
+		// Logs with the fields of the request, e.g. the request and trace ids
+		log := logger.FromContext(r.Context())
+
+		bytes := zap.Int("bytes", recorder.Bytes)
+
 		if recorder.Status >= 400 && recorder.Status < 500 {
-			logger.HttpWarn("Client error", method, uri, status)
+			log.Info("Client error", method, uri, status, bytes)
 		} else if recorder.Status >= 500 {
-			logger.HttpError("Internal error", method, uri, status)
+			log.Error("Internal error", method, uri, status, bytes)
 		} else {
-			logger.Info("Request received", method, uri, duration, status)
+			log.Info("Request received", method, uri, duration, status, bytes)
+		}
+
+	})
+}
+
+// It counts each request and measures its latency for prometheus,
+// labeled by the route template so that short urls do not create new series
+func Metrics(h http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		startTime := time.Now()
+
+		recorder := &ResponseRecorder{
+			ResponseWriter: w,
+			Status:         200,
 		}
 
+		h.ServeHTTP(recorder, r)
+
+		route := routeTemplate(r)
+		status := metrics.StatusClass(recorder.Status)
+
+		metrics.HttpRequests.WithLabelValues(route, r.Method, status).Inc()
+		metrics.HttpDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(startTime).Seconds())
 	})
 }
 
+// It starts a span for each request, continuing the trace of the client if a W3C traceparent header is sent.
+// The trace and span ids are added to every log line of the request.
+func Tracing(h http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := routeTemplate(r)
+
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", route, r)...),
+		)
+		defer span.End()
+
+		if spanContext := span.SpanContext(); spanContext.IsValid() {
+			ctx = logger.WithFields(ctx,
+				zap.String("trace_id", spanContext.TraceID().String()),
+				zap.String("span_id", spanContext.SpanID().String()),
+			)
+		}
+
+		recorder := &ResponseRecorder{
+			ResponseWriter: w,
+			Status:         200,
+		}
+
+		h.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(recorder.Status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(recorder.Status))
+	})
+}
+
+// Returns the template of the matched route, e.g. /info/{shortUrl}, so that short urls
+// do not end up in metric labels or span names
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "not_found"
+}
+
 type ResponseRecorder struct {
 	http.ResponseWriter
 	Status int
+	Bytes  int
 }
 
 func (r *ResponseRecorder) WriteHeader(status int) {
 	r.Status = status
 	r.ResponseWriter.WriteHeader(status)
 }
+
+func (r *ResponseRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += n
+	return n, err
+}
+
+// Lets handlers stream responses (e.g. analytics exports) through the recorder
+func (r *ResponseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/helpers"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"fmt"
+	"math"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// Rate limiting policies of the configuration
+const (
+	RateLimitShorten = "shorten"
+	RateLimitResolve = "resolve"
+)
+
+// It limits the requests of every client with a token bucket of the policy, shared by all replicas through redis.
+// Clients are identified by their IP. It runs before Auth, so requests with wrong credentials are limited too,
+// api keys have their own rate limit on top of it.
+// If redis is unavailable requests are let through, the handler reports the error.
+func RateLimit(policy string, h http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conf := config.Get()
+
+		limit := conf.RateLimit.Shorten
+		if policy == RateLimitResolve {
+			limit = conf.RateLimit.Resolve
+		}
+		if !conf.RateLimit.Enabled || limit.RequestsPerMinute <= 0 || limit.Burst <= 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		client := "ip:" + helpers.ClientIP(r)
+
+		result, err := redisStorage.TakeToken(r.Context(), policy+":"+client, limit.RequestsPerMinute, limit.Burst)
+		if err != nil {
+			logger.FromContext(r.Context()).Error("Could not check rate limit", zap.Error(err))
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if !allow(w, r, result, "rate limit exceeded") {
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Sets the RateLimit headers of the result. If the request is not allowed
+// the 429 response is written and false is returned.
+func allow(w http.ResponseWriter, r *http.Request, result redisStorage.RateLimitResult, message string) bool {
+	w.Header().Set("RateLimit-Limit", fmt.Sprint(result.Limit))
+	w.Header().Set("RateLimit-Remaining", fmt.Sprint(result.Remaining))
+	w.Header().Set("RateLimit-Reset", fmt.Sprint(int64(math.Ceil(result.Reset.Seconds()))))
+
+	if result.Allowed {
+		return true
+	}
+
+	w.Header().Set("Retry-After", fmt.Sprint(int64(math.Ceil(result.RetryAfter.Seconds()))))
+	JSONError(w, r, http.StatusTooManyRequests, message)
+	return false
+}
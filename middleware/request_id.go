@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"ilmavridis/url-shortener/helpers"
+	"ilmavridis/url-shortener/logger"
+
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// It reuses the X-Request-ID sent by the client or generates a new one, and echoes it in the response.
+// The request id, the client, and the short url are added to every log line of the request.
+func RequestID(h http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, requestID)
+
+		fields := []zap.Field{
+			zap.String("request_id", requestID),
+			zap.String("remote_ip", helpers.ClientIP(r)),
+			zap.String("user_agent", r.UserAgent()),
+		}
+		if shortUrl, ok := mux.Vars(r)["shortUrl"]; ok {
+			fields = append(fields, zap.String("short", shortUrl))
+		}
+		ctx = logger.WithFields(ctx, fields...)
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Returns the request id of the request that ctx belongs to
+func GetRequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// Request ids from clients end up in logs and responses, so only short printable values are accepted
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > 128 {
+		return false
+	}
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package policy
+
+import (
+	"ilmavridis/url-shortener/helpers"
+
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnresolvable is returned for urls whose host has no IP address
+var ErrUnresolvable = errors.New("url host could not be resolved")
+
+// Resolver looks up the IP addresses of a host, *net.Resolver implements it
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+var (
+	resolverMu sync.RWMutex
+	resolver   Resolver = net.DefaultResolver
+)
+
+// Sets the resolver of destination checks, e.g. a static one for tests
+func SetResolver(r Resolver) {
+	resolverMu.Lock()
+	defer resolverMu.Unlock()
+	resolver = r
+}
+
+func getResolver() Resolver {
+	resolverMu.RLock()
+	defer resolverMu.RUnlock()
+	return resolver
+}
+
+// Schemes of urls that can be shortened when none are configured
+var defaultSchemes = []string{"http", "https"}
+
+// Time to resolve the host of a url when none is configured
+const defaultResolveTimeout = 2 * time.Second
+
+// Cloud metadata services that are not in the link-local range
+var metadataIPs = []net.IP{
+	net.ParseIP("fd00:ec2::254"),   // AWS IPv6
+	net.ParseIP("100.100.100.200"), // Alibaba Cloud
+}
+
+// Returns the lowercase scheme of a url, http for urls without a scheme like www.example.com or localhost:8080
+func urlScheme(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Scheme == "" {
+		return "http"
+	}
+
+	// A host and port without a scheme is parsed as a scheme and an opaque path
+	if !strings.Contains(rawUrl, "://") && u.Opaque != "" && u.Opaque[0] >= '0' && u.Opaque[0] <= '9' {
+		return "http"
+	}
+
+	return strings.ToLower(u.Scheme)
+}
+
+// Returns the kind of internal address of an IP, empty for public addresses
+func internalAddress(ip net.IP) string {
+	for _, metadata := range metadataIPs {
+		if metadata.Equal(ip) {
+			return "metadata"
+		}
+	}
+
+	switch {
+	case ip.IsLoopback():
+		return "loopback"
+	case ip.IsUnspecified():
+		return "unspecified"
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		// Includes the metadata services of most clouds at 169.254.169.254
+		return "link-local"
+	case ip.IsPrivate():
+		return "private"
+	}
+
+	// 0.0.0.0/8 reaches the local host on most systems
+	if ip4 := ip.To4(); ip4 != nil && ip4[0] == 0 {
+		return "unspecified"
+	}
+
+	return ""
+}
+
+// Checks that the scheme of a url is allowed. A *Violation is returned if it isn't.
+func (e *Engine) CheckScheme(rawUrl string) error {
+	if scheme := urlScheme(rawUrl); !e.schemes[scheme] {
+		return &Violation{Rule: "scheme:" + scheme}
+	}
+	return nil
+}
+
+// Checks that a url can be fetched safely: its scheme is allowed and its host doesn't resolve
+// to a loopback, link-local, private or metadata address outside of the allowed internal ranges.
+// A *Violation is returned for unsafe urls and ErrUnresolvable for hosts without addresses.
+func (e *Engine) CheckDestination(ctx context.Context, rawUrl string) error {
+	if err := e.CheckScheme(rawUrl); err != nil {
+		return err
+	}
+
+	u, err := helpers.ParseURL(rawUrl)
+	if err != nil {
+		return &Violation{Rule: "invalid url"}
+	}
+	host := helpers.Hostname(u)
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, e.resolveTimeout)
+		defer cancel()
+
+		addrs, err := getResolver().LookupIPAddr(ctx, host)
+		if err != nil || len(addrs) == 0 {
+			return fmt.Errorf("%w: %s", ErrUnresolvable, host)
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	// Every address is checked, the one used to fetch the url can't be known in advance
+	for _, ip := range ips {
+		if err := e.CheckIP(ip); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Checks that an IP is public or in the allowed internal ranges. A *Violation is returned if it isn't.
+func (e *Engine) CheckIP(ip net.IP) error {
+	kind := internalAddress(ip)
+	if kind == "" {
+		return nil
+	}
+
+	for _, ipNet := range e.allowInternal {
+		if ipNet.Contains(ip) {
+			return nil
+		}
+	}
+
+	return &Violation{Rule: "internal:" + kind}
+}
+
+// Checks the scheme of a url against the configured policy. A *Violation is returned if it isn't allowed.
+func CheckScheme(rawUrl string) error {
+	if err := Init(); err != nil {
+		return err
+	}
+	return engine.CheckScheme(rawUrl)
+}
+
+// Checks that a url of the configured policy can be fetched safely, see Engine.CheckDestination
+func CheckDestination(ctx context.Context, rawUrl string) error {
+	if err := Init(); err != nil {
+		return err
+	}
+	return engine.CheckDestination(ctx, rawUrl)
+}
+
+// Checks that an IP of the configured policy is safe to connect to, see Engine.CheckIP
+func CheckIP(ip net.IP) error {
+	if err := Init(); err != nil {
+		return err
+	}
+	return engine.CheckIP(ip)
+}
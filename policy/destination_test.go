@@ -0,0 +1,82 @@
+package policy
+
+import (
+	"ilmavridis/url-shortener/config"
+
+	"net"
+	"testing"
+)
+
+func TestUrlScheme(t *testing.T) {
+	tests := map[string]string{
+		"https://www.testsite1.com": "https",
+		"HTTP://www.testsite1.com":  "http",
+		"www.testsite1.com":         "http",
+		"localhost:8080/admin":      "http",
+		"javascript:alert(1)":       "javascript",
+		"data:text/html,hello":      "data",
+		"file:///etc/passwd":        "file",
+	}
+	for url, want := range tests {
+		if scheme := urlScheme(url); scheme != want {
+			t.Errorf("Error: Wrong scheme of %s: got %q want %q", url, scheme, want)
+		}
+	}
+}
+
+func TestCheckIP(t *testing.T) {
+	var conf config.Config
+	conf.Policy.AllowInternal = []string{"10.20.0.0/16"}
+	e, err := New(conf)
+	if err != nil {
+		t.Fatalf("Error at creating policy engine: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		rule string
+	}{
+		{"93.184.216.34", ""},
+		{"2606:2800:220:1::1", ""},
+		{"127.0.0.1", "internal:loopback"},
+		{"::ffff:127.0.0.1", "internal:loopback"},
+		{"0.0.0.0", "internal:unspecified"},
+		{"0.1.2.3", "internal:unspecified"},
+		{"169.254.169.254", "internal:link-local"},
+		{"fe80::1", "internal:link-local"},
+		{"fd00:ec2::254", "internal:metadata"},
+		{"172.16.5.4", "internal:private"},
+		{"fc00::1", "internal:private"},
+		{"10.20.0.5", ""},
+	}
+	for _, test := range tests {
+		rule := ""
+		if err := e.CheckIP(net.ParseIP(test.ip)); err != nil {
+			rule = err.(*Violation).Rule
+		}
+		if rule != test.rule {
+			t.Errorf("Error: Wrong rule for %s: got %q want %q", test.ip, rule, test.rule)
+		}
+	}
+
+	conf.Policy.AllowInternal = []string{"10.20.0.0"}
+	if _, err := New(conf); err == nil {
+		t.Errorf("Error: Invalid internal cidr accepted")
+	}
+}
+
+func TestCheckScheme(t *testing.T) {
+	var conf config.Config
+	conf.Policy.Schemes = []string{"HTTPS"}
+	e, err := New(conf)
+	if err != nil {
+		t.Fatalf("Error at creating policy engine: %v", err)
+	}
+
+	if err := e.CheckScheme("https://www.testsite1.com"); err != nil {
+		t.Errorf("Error: Scheme https blocked: %v", err)
+	}
+	if err := e.CheckScheme("http://www.testsite1.com"); err == nil || err.(*Violation).Rule != "scheme:http" {
+		t.Errorf("Error: Scheme http not blocked: got %v", err)
+	}
+}
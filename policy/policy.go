@@ -0,0 +1,273 @@
+package policy
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/helpers"
+	"ilmavridis/url-shortener/logger"
+
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Violation is returned for urls that the policy does not allow
+type Violation struct {
+	Rule string // The block rule that matched, e.g. domain:example.com, or "default" if no rule matched
+}
+
+func (v *Violation) Error() string {
+	return "url blocked by policy rule " + v.Rule
+}
+
+// Format of the rules in the configuration and in the rules file
+type ruleList struct {
+	Domains []string `mapstructure:"domains"`
+	Regexes []string `mapstructure:"regexes"`
+	CIDRs   []string `mapstructure:"cidrs"`
+}
+
+type fileRules struct {
+	Allow ruleList `mapstructure:"allow"`
+	Block ruleList `mapstructure:"block"`
+}
+
+type rules struct {
+	domains []string
+	regexes []*regexp.Regexp
+	cidrs   []*net.IPNet
+}
+
+func compile(list ruleList) (rules, error) {
+	r := rules{domains: list.Domains}
+
+	for _, expr := range list.Regexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return r, fmt.Errorf("regex %q: %v", expr, err)
+		}
+		r.regexes = append(r.regexes, re)
+	}
+
+	for _, cidr := range list.CIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return r, fmt.Errorf("cidr %q: %v", cidr, err)
+		}
+		r.cidrs = append(r.cidrs, ipNet)
+	}
+
+	return r, nil
+}
+
+// Returns the first rule that matches the url, empty if none does.
+// Regexes match the normalized url, see normalize.
+func (r rules) match(u *url.URL, normalized string) string {
+	host := helpers.Hostname(u)
+
+	for _, domain := range r.domains {
+		if helpers.MatchDomain(host, domain) {
+			return "domain:" + domain
+		}
+	}
+
+	for _, re := range r.regexes {
+		if re.MatchString(normalized) {
+			return "regex:" + re.String()
+		}
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, ipNet := range r.cidrs {
+			if ipNet.Contains(ip) {
+				return "cidr:" + ipNet.String()
+			}
+		}
+	}
+
+	return ""
+}
+
+// Engine decides which urls can be shortened. Allow rules are exceptions to the block rules,
+// urls that match no rule follow the default action.
+type Engine struct {
+	defaultBlock bool
+	allow        rules // From the configuration
+	block        rules
+
+	mu        sync.RWMutex
+	fileAllow rules // From the rules file, replaced when it changes
+	fileBlock rules
+
+	schemes        map[string]bool
+	allowInternal  []*net.IPNet // Internal ranges that destinations may resolve to
+	resolveTimeout time.Duration
+}
+
+// Creates the engine of the policy configuration and watches its rules file
+func New(conf config.Config) (*Engine, error) {
+	policy := conf.Policy
+
+	e := &Engine{}
+	switch policy.DefaultAction {
+	case "", "allow":
+	case "block":
+		e.defaultBlock = true
+	default:
+		return nil, fmt.Errorf("unknown default action %q", policy.DefaultAction)
+	}
+
+	var err error
+	if e.allow, err = compile(ruleList(policy.Allow)); err != nil {
+		return nil, err
+	}
+	if e.block, err = compile(ruleList(policy.Block)); err != nil {
+		return nil, err
+	}
+
+	schemes := policy.Schemes
+	if len(schemes) == 0 {
+		schemes = defaultSchemes
+	}
+	e.schemes = map[string]bool{}
+	for _, scheme := range schemes {
+		e.schemes[strings.ToLower(scheme)] = true
+	}
+
+	for _, cidr := range policy.AllowInternal {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("internal cidr %q: %v", cidr, err)
+		}
+		e.allowInternal = append(e.allowInternal, ipNet)
+	}
+
+	e.resolveTimeout = policy.ResolveTimeout
+	if e.resolveTimeout <= 0 {
+		e.resolveTimeout = defaultResolveTimeout
+	}
+
+	if policy.File != "" {
+		if err := e.watch(policy.File); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// Loads the rules file and reloads it every time it changes.
+// Invalid changes are logged and the previous rules are kept.
+func (e *Engine) watch(file string) error {
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	if err := e.load(v); err != nil {
+		return err
+	}
+
+	v.OnConfigChange(func(event fsnotify.Event) {
+		if err := e.load(v); err != nil {
+			logger.Error("Could not reload policy rules, keeping the previous ones: ", err)
+			return
+		}
+		logger.Info("Policy rules reloaded", zap.String("file", file))
+	})
+	v.WatchConfig()
+
+	return nil
+}
+
+func (e *Engine) load(v *viper.Viper) error {
+	var file fileRules
+	if err := v.Unmarshal(&file); err != nil {
+		return err
+	}
+
+	allow, err := compile(file.Allow)
+	if err != nil {
+		return err
+	}
+	block, err := compile(file.Block)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.fileAllow = allow
+	e.fileBlock = block
+	e.mu.Unlock()
+
+	return nil
+}
+
+// Returns the url that regexes are matched against, with a scheme and a lowercase scheme and host,
+// so e.g. www.evil.com/phish and HTTP://EVIL.com/phish can't get around a rule for http://evil.com/phish
+func normalize(u *url.URL) string {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	return n.String()
+}
+
+// Checks a url against the rules. A *Violation is returned if the url is blocked.
+func (e *Engine) Check(rawUrl string) error {
+	u, err := helpers.ParseURL(rawUrl)
+	if err != nil {
+		return &Violation{Rule: "invalid url"}
+	}
+
+	normalized := normalize(u)
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.allow.match(u, normalized) != "" || e.fileAllow.match(u, normalized) != "" {
+		return nil
+	}
+
+	if rule := e.block.match(u, normalized); rule != "" {
+		return &Violation{Rule: rule}
+	}
+	if rule := e.fileBlock.match(u, normalized); rule != "" {
+		return &Violation{Rule: rule}
+	}
+
+	if e.defaultBlock {
+		return &Violation{Rule: "default"}
+	}
+	return nil
+}
+
+var (
+	engineOnce sync.Once
+	engine     *Engine
+	engineErr  error
+)
+
+// Init creates the engine of the configured policy
+func Init() error {
+	engineOnce.Do(func() {
+		engine, engineErr = New(config.Get())
+	})
+
+	return engineErr
+}
+
+// Checks a url against the configured policy. A *Violation is returned if the url is blocked.
+func Check(rawUrl string) error {
+	if err := Init(); err != nil {
+		return err
+	}
+	return engine.Check(rawUrl)
+}
@@ -0,0 +1,116 @@
+package policy
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func checkRule(e *Engine, url string) string {
+	err := e.Check(url)
+	if err == nil {
+		return ""
+	}
+	if violation, ok := err.(*Violation); ok {
+		return violation.Rule
+	}
+	return err.Error()
+}
+
+func TestCheck(t *testing.T) {
+	var conf config.Config
+	conf.Policy.Allow.Domains = []string{"safe.blocked.example.com"}
+	conf.Policy.Block.Domains = []string{"blocked.example.com"}
+	conf.Policy.Block.Regexes = []string{`^https?://[^/]+/phishing`}
+	conf.Policy.Block.CIDRs = []string{"192.168.0.0/16"}
+
+	e, err := New(conf)
+	if err != nil {
+		t.Fatalf("Error at creating policy engine: %v", err)
+	}
+
+	tests := []struct {
+		url  string
+		rule string
+	}{
+		{"http://www.testsite1.com", ""},
+		{"https://blocked.example.com/login", "domain:blocked.example.com"},
+		{"https://Login.Blocked.Example.com.", "domain:blocked.example.com"},
+		{"notblocked.example.com", ""},
+		{"https://safe.blocked.example.com/", ""},
+		{"http://www.testsite1.com/phishing/form", "regex:^https?://[^/]+/phishing"},
+		{"www.testsite1.com/phishing/form", "regex:^https?://[^/]+/phishing"},
+		{"HTTP://WWW.TestSite1.com/phishing", "regex:^https?://[^/]+/phishing"},
+		{"http://192.168.1.10:8080/admin", "cidr:192.168.0.0/16"},
+		{"http://192.169.1.10/", ""},
+	}
+	for _, test := range tests {
+		if rule := checkRule(e, test.url); rule != test.rule {
+			t.Errorf("Error: Wrong rule for %s: got %q want %q", test.url, rule, test.rule)
+		}
+	}
+
+	// Only allowed urls pass when the default action is block
+	conf.Policy.DefaultAction = "block"
+	e, _ = New(conf)
+	if rule := checkRule(e, "http://www.testsite1.com"); rule != "default" {
+		t.Errorf("Error: Wrong rule: got %q want %q", rule, "default")
+	}
+	if rule := checkRule(e, "https://safe.blocked.example.com"); rule != "" {
+		t.Errorf("Error: Wrong rule: got %q want %q", rule, "")
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	var conf config.Config
+	conf.Policy.Block.Regexes = []string{"("}
+	if _, err := New(conf); err == nil {
+		t.Errorf("Error: Invalid regex accepted")
+	}
+
+	conf.Policy.Block.Regexes = nil
+	conf.Policy.Block.CIDRs = []string{"10.0.0.0"}
+	if _, err := New(conf); err == nil {
+		t.Errorf("Error: Invalid cidr accepted")
+	}
+}
+
+func TestReload(t *testing.T) {
+	logger.New()
+
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := ioutil.WriteFile(file, []byte("block:\n  domains: [\"first.example.com\"]\n"), 0644); err != nil {
+		t.Fatalf("Error at writing rules file: %v", err)
+	}
+
+	var conf config.Config
+	conf.Policy.File = file
+	e, err := New(conf)
+	if err != nil {
+		t.Fatalf("Error at creating policy engine: %v", err)
+	}
+
+	if rule := checkRule(e, "http://first.example.com"); rule != "domain:first.example.com" {
+		t.Errorf("Error: Wrong rule: got %q want %q", rule, "domain:first.example.com")
+	}
+
+	if err := ioutil.WriteFile(file, []byte("block:\n  domains: [\"second.example.com\"]\n"), 0644); err != nil {
+		t.Fatalf("Error at writing rules file: %v", err)
+	}
+
+	// The file is reloaded in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for checkRule(e, "http://second.example.com") == "" && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if rule := checkRule(e, "http://second.example.com"); rule != "domain:second.example.com" {
+		t.Errorf("Error: Rules file not reloaded: got %q want %q", rule, "domain:second.example.com")
+	}
+	if rule := checkRule(e, "http://first.example.com"); rule != "" {
+		t.Errorf("Error: Old rule still applied: got %q", rule)
+	}
+}
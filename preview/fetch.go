@@ -0,0 +1,231 @@
+package preview
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/policy"
+
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	// Only the head of a page is needed, larger pages are cut
+	maxPageBytes    = 512 * 1024
+	maxFaviconBytes = 32 * 1024
+	maxRedirects    = 5
+	maxTitleLength  = 200
+
+	// Used when none is configured
+	defaultTimeout = 5 * time.Second
+)
+
+// Icons that are shown on the preview page, svg is left out because it can contain scripts
+var faviconTypes = map[string]bool{
+	"image/x-icon":             true,
+	"image/vnd.microsoft.icon": true,
+	"image/png":                true,
+	"image/gif":                true,
+	"image/jpeg":               true,
+	"image/webp":               true,
+}
+
+// Returns an http client that only connects to addresses that the url policy allows.
+// The address is checked when the connection is made, after the host was resolved,
+// so a host can't pass the check and then resolve to an internal address.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			return policy.CheckIP(net.ParseIP(host))
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// Proxies of the environment would be checked instead of the destination
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if err := policy.CheckScheme(req.URL.String()); err != nil {
+				return err
+			}
+			return policy.Check(req.URL.String())
+		},
+	}
+}
+
+// Fetches the title and the favicon of a page
+func Fetch(ctx context.Context, pageUrl string) (title string, favicon string, err error) {
+	timeout := config.Get().Preview.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	client := newClient(timeout)
+
+	// Fails fast for urls that were allowed when they were shortened, the rules may have changed since
+	if err := policy.Check(pageUrl); err != nil {
+		return "", "", err
+	}
+	if err := policy.CheckDestination(ctx, pageUrl); err != nil {
+		return "", "", err
+	}
+
+	resp, err := get(ctx, client, pageUrl)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("status %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return "", "", fmt.Errorf("not an html page: %s", mediaType)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, maxPageBytes), resp.Header.Get("Content-Type"))
+	if err != nil {
+		return "", "", err
+	}
+	title, icon := parsePage(body)
+
+	// Relative to the page after its redirects
+	iconUrl, err := resp.Request.URL.Parse(icon)
+	if err != nil {
+		return title, "", nil
+	}
+	// A missing favicon doesn't fail the preview
+	favicon, _ = fetchFavicon(ctx, client, iconUrl)
+
+	return title, favicon, nil
+}
+
+func get(ctx context.Context, client *http.Client, rawUrl string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "url-shortener-preview/1.0")
+
+	return client.Do(req)
+}
+
+// Returns the title of a page and the url of its icon, /favicon.ico when it doesn't link one
+func parsePage(body io.Reader) (string, string) {
+	var title strings.Builder
+	icon := "/favicon.ico"
+	iconFound, inTitle := false, false
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return cleanTitle(title.String()), icon
+		case html.TextToken:
+			if inTitle {
+				title.Write(tokenizer.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "title":
+				inTitle = title.Len() == 0
+			case "link":
+				if href, ok := iconLink(token); ok && !iconFound {
+					icon, iconFound = href, true
+				}
+			case "body":
+				// Everything needed is in the head
+				return cleanTitle(title.String()), icon
+			}
+		case html.EndTagToken:
+			if tokenizer.Token().Data == "title" {
+				inTitle = false
+			}
+		}
+	}
+}
+
+// Returns the href of <link rel="icon"> and <link rel="shortcut icon">
+func iconLink(token html.Token) (string, bool) {
+	var rel, href string
+	for _, attr := range token.Attr {
+		switch attr.Key {
+		case "rel":
+			rel = strings.ToLower(attr.Val)
+		case "href":
+			href = strings.TrimSpace(attr.Val)
+		}
+	}
+
+	for _, value := range strings.Fields(rel) {
+		if value == "icon" && href != "" {
+			return href, true
+		}
+	}
+	return "", false
+}
+
+func cleanTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength]) + "…"
+	}
+	return title
+}
+
+// Returns the favicon as a data url, so the preview page doesn't make clients contact the destination
+func fetchFavicon(ctx context.Context, client *http.Client, iconUrl *url.URL) (string, error) {
+	if iconUrl.Scheme != "http" && iconUrl.Scheme != "https" {
+		return "", fmt.Errorf("unsupported favicon url %s", iconUrl)
+	}
+
+	if err := policy.Check(iconUrl.String()); err != nil {
+		return "", err
+	}
+
+	resp, err := get(ctx, client, iconUrl.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode != http.StatusOK || !faviconTypes[mediaType] {
+		return "", fmt.Errorf("no favicon at %s", iconUrl)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFaviconBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxFaviconBytes {
+		return "", fmt.Errorf("favicon at %s is too large", iconUrl)
+	}
+
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
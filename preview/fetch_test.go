@@ -0,0 +1,84 @@
+package preview
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/policy"
+
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		page  string
+		title string
+		icon  string
+	}{
+		{`<html><head><title>
+			Example   Domain
+		</title><link rel="stylesheet" href="/style.css"><link rel="shortcut icon" href="/static/icon.png"></head><body></body></html>`, "Example Domain", "/static/icon.png"},
+		{`<html><head><TITLE>Caf&eacute; &amp; Bar</TITLE><link rel="Icon" href="https://cdn.example.com/i.ico"><link rel="icon" href="/other.ico"></head></html>`, "Café & Bar", "https://cdn.example.com/i.ico"},
+		// Titles and icons after the head are not read
+		{`<html><head></head><body><svg><title>Chart</title></svg><link rel="icon" href="/body.ico"></body></html>`, "", "/favicon.ico"},
+		{`<title>` + strings.Repeat("a", 300) + `</title>`, strings.Repeat("a", 200) + "…", "/favicon.ico"},
+	}
+
+	for _, test := range tests {
+		title, icon := parsePage(strings.NewReader(test.page))
+		if title != test.title || icon != test.icon {
+			t.Errorf("Error: Wrong title and icon: got %q %q want %q %q", title, icon, test.title, test.icon)
+		}
+	}
+}
+
+func TestFetchInternalAddress(t *testing.T) {
+	logger.New()
+	config.Read()
+	if err := policy.Init(); err != nil {
+		t.Fatalf("Error at loading the url policy: %v", err)
+	}
+
+	fetched := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = true
+		fmt.Fprint(w, "<title>Internal</title>")
+	}))
+	defer server.Close()
+
+	_, _, err := Fetch(context.Background(), server.URL)
+	var violation *policy.Violation
+	if !errors.As(err, &violation) || violation.Rule != "internal:loopback" {
+		t.Errorf("Error: Expected the loopback address to be blocked, got %v", err)
+	}
+
+	// The address is checked again when connecting, for hosts that resolve to another one later
+	_, err = newClient(time.Second).Get(server.URL)
+	if !errors.As(err, &violation) || violation.Rule != "internal:loopback" {
+		t.Errorf("Error: Expected the connection to be blocked, got %v", err)
+	}
+	if fetched {
+		t.Errorf("Error: The internal address was fetched")
+	}
+}
+
+func TestFetchBlocked(t *testing.T) {
+	logger.New()
+	config.Read()
+	if err := policy.Init(); err != nil {
+		t.Fatalf("Error at loading the url policy: %v", err)
+	}
+
+	// Blocked after the url was shortened, it is not fetched even if it resolves
+	_, _, err := Fetch(context.Background(), "https://blocked.example.com/page")
+	var violation *policy.Violation
+	if !errors.As(err, &violation) || violation.Rule != "domain:blocked.example.com" {
+		t.Errorf("Error: Expected the url to be blocked by the policy, got %v", err)
+	}
+}
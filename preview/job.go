@@ -0,0 +1,94 @@
+package preview
+
+import (
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Short urls taken from the queue at once
+const queueBatchSize = 20
+
+// Fetches the destinations of queued short urls every interval until the context is canceled.
+// Every replica takes its own short urls from the queue.
+func RunPeriodic(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		client, err := redisStorage.NewClient()
+		if err != nil {
+			logger.Error("Could not connect to redis to fetch previews: ", err)
+			continue
+		}
+
+		fetched, err := ProcessQueue(ctx, client)
+		if err != nil {
+			logger.Error("Could not fetch previews: ", err)
+		}
+		if fetched > 0 {
+			logger.Info("Previews fetched", zap.Int("fetched", fetched))
+		}
+
+		client.Close()
+	}
+}
+
+// Fetches the title and favicon of the destinations of the queued short urls until the queue is empty.
+// It returns the number of previews that were stored, including those of pages that could not be fetched.
+func ProcessQueue(ctx context.Context, client *redis.Client) (int, error) {
+	fetched := 0
+
+	for {
+		shortUrls, err := redisStorage.NextPreviews(ctx, client, queueBatchSize)
+		if err != nil || len(shortUrls) == 0 {
+			return fetched, err
+		}
+
+		for i, shortUrl := range shortUrls {
+			ok, err := fetchPreview(ctx, client, shortUrl)
+			if err != nil {
+				// The batch was taken from the queue, so the short urls that are left are queued again
+				if err := redisStorage.RequeuePreviews(ctx, client, shortUrls[i:]); err != nil {
+					logger.Error("Could not queue previews again: ", err)
+				}
+				return fetched, err
+			}
+			if ok {
+				fetched++
+			}
+		}
+	}
+}
+
+// Fetches and stores the preview of a short url. It returns false if the short url expired meanwhile or is disabled.
+func fetchPreview(ctx context.Context, client *redis.Client, shortUrl string) (bool, error) {
+	longUrl, ok, err := redisStorage.PreviewDestination(ctx, client, shortUrl)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	preview := redisStorage.Preview{Url: longUrl, FetchedAt: time.Now().UTC()}
+	preview.Title, preview.Favicon, err = Fetch(ctx, longUrl)
+	if err != nil {
+		// Stored too, so the page is not fetched again on every view
+		preview.Error = err.Error()
+		logger.Info("Could not fetch preview", zap.String("short", shortUrl), zap.Error(err))
+	}
+
+	if err := redisStorage.SavePreview(ctx, client, shortUrl, preview); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,106 @@
+package redisStorage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// APIKey is stored under the hash of the key, the key itself is never stored
+type APIKey struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Scopes         []string  `json:"scopes"`
+	RateLimit      int64     `json:"rate_limit"` // Requests per minute, 0 means unlimited
+	Workspace      string    `json:"workspace,omitempty"`
+	MaxLinks       int64     `json:"max_links"`         // Active short urls created with the key, 0 means unlimited
+	MaxLinksPerDay int64     `json:"max_links_per_day"` // Short urls created per day (UTC), 0 means unlimited
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Maps the id of every api key to its hash, so keys can be listed and revoked by id
+const apiKeysIndex = "apikeys"
+
+func apiKeyKey(hash string) string {
+	return "apikey:" + hash
+}
+
+func SaveAPIKey(ctx context.Context, hash string, key APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	pipe := Get().TxPipeline()
+	pipe.Set(ctx, apiKeyKey(hash), data, 0)
+	pipe.HSet(ctx, apiKeysIndex, key.ID, hash)
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// Returns the api key with the given hash. The boolean is false if the key does not exist or was revoked.
+func GetAPIKey(ctx context.Context, hash string) (APIKey, bool, error) {
+	var key APIKey
+
+	data, err := Get().Get(ctx, apiKeyKey(hash)).Bytes()
+	if err == redis.Nil {
+		return key, false, nil
+	} else if err != nil {
+		return key, false, err
+	}
+
+	err = json.Unmarshal(data, &key)
+	return key, err == nil, err
+}
+
+// Returns the api key with the given id. The boolean is false if there is no such key.
+func GetAPIKeyByID(ctx context.Context, id string) (APIKey, bool, error) {
+	hash, err := Get().HGet(ctx, apiKeysIndex, id).Result()
+	if err == redis.Nil {
+		return APIKey{}, false, nil
+	} else if err != nil {
+		return APIKey{}, false, err
+	}
+
+	return GetAPIKey(ctx, hash)
+}
+
+func ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	hashes, err := Get().HVals(ctx, apiKeysIndex).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]APIKey, 0, len(hashes))
+	for _, hash := range hashes {
+		key, found, err := GetAPIKey(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// Deletes the api key with the given id. The boolean is false if there is no such key.
+func RevokeAPIKey(ctx context.Context, id string) (bool, error) {
+	hash, err := Get().HGet(ctx, apiKeysIndex, id).Result()
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	pipe := Get().TxPipeline()
+	pipe.Del(ctx, apiKeyKey(hash))
+	pipe.HDel(ctx, apiKeysIndex, id)
+	_, err = pipe.Exec(ctx)
+
+	return err == nil, err
+}
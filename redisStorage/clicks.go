@@ -0,0 +1,103 @@
+package redisStorage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ilmavridis/url-shortener/config"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Click is a single resolution of a short url, kept for analytics
+type Click struct {
+	ID        string    `json:"-"`
+	Timestamp time.Time `json:"timestamp"`
+	RemoteIP  string    `json:"remote_ip"`
+	UserAgent string    `json:"user_agent"`
+	Referer   string    `json:"referer"`
+	Variant   string    `json:"variant,omitempty"` // Variant of the short url that the click was redirected to
+}
+
+func clicksKey(shortUrl string) string {
+	return dataKey("clicks:", shortUrl)
+}
+
+// Appends a click to the click log of a short url and counts it for its variant.
+// The log is trimmed to approximately stats.maxClicks entries and expires together with the short url.
+func RecordClick(ctx context.Context, shortUrl string, click Click) error {
+	conf := config.Get()
+
+	pipe := Get().TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: clicksKey(shortUrl),
+		MaxLen: conf.Stats.MaxClicks,
+		Approx: true,
+		Values: map[string]interface{}{
+			"remote_ip":  click.RemoteIP,
+			"user_agent": click.UserAgent,
+			"referer":    click.Referer,
+			"variant":    click.Variant,
+		},
+	})
+	pipe.Expire(ctx, clicksKey(shortUrl), conf.Redis.Expiry)
+	// Counted apart from the log, so trimming it doesn't change the counts
+	if click.Variant != "" {
+		pipe.HIncrBy(ctx, variantClicksKey(shortUrl), click.Variant, 1)
+		pipe.Expire(ctx, variantClicksKey(shortUrl), conf.Redis.Expiry)
+	}
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// Returns up to count clicks of a short url that happened in [from, to], starting after the click
+// with id after. An empty after starts from the beginning of the range.
+// The click timestamps come from the stream ids, so the range lookup does not scan the whole log.
+func ClickRange(ctx context.Context, shortUrl string, from time.Time, to time.Time, after string, count int64) ([]Click, error) {
+	start := strconv.FormatInt(from.UnixMilli(), 10)
+	if after != "" {
+		start = nextStreamID(after)
+	}
+	end := strconv.FormatInt(to.UnixMilli(), 10)
+
+	messages, err := Get().XRangeN(ctx, clicksKey(shortUrl), start, end, count).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	clicks := make([]Click, 0, len(messages))
+	for _, message := range messages {
+		// Clicks logged before variants were introduced don't have one
+		variant, _ := message.Values["variant"].(string)
+		clicks = append(clicks, Click{
+			ID:        message.ID,
+			Timestamp: streamIDTime(message.ID),
+			RemoteIP:  fmt.Sprint(message.Values["remote_ip"]),
+			UserAgent: fmt.Sprint(message.Values["user_agent"]),
+			Referer:   fmt.Sprint(message.Values["referer"]),
+			Variant:   variant,
+		})
+	}
+
+	return clicks, nil
+}
+
+// Stream ids have the form <milliseconds>-<sequence>
+func streamIDTime(id string) time.Time {
+	ms, _ := strconv.ParseInt(strings.Split(id, "-")[0], 10, 64)
+	return time.UnixMilli(ms).UTC()
+}
+
+// Returns the smallest stream id that is greater than id
+func nextStreamID(id string) string {
+	parts := strings.Split(id, "-")
+	if len(parts) != 2 {
+		return id
+	}
+	seq, _ := strconv.ParseUint(parts[1], 10, 64)
+	return fmt.Sprintf("%s-%d", parts[0], seq+1)
+}
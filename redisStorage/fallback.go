@@ -0,0 +1,43 @@
+package redisStorage
+
+import (
+	"ilmavridis/url-shortener/config"
+
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func fallbackKey(shortUrl string) string {
+	return dataKey("fallback:", shortUrl)
+}
+
+// Fallback urls outlive their short urls for the configured retention, so expired short urls still lead somewhere
+func fallbackExpiry(expiry time.Duration) time.Duration {
+	return expiry + config.Get().Fallback.Retention
+}
+
+// Sets the url that clients are redirected to when the short url is expired, disabled or exhausted.
+// An empty url removes it.
+func SetFallback(ctx context.Context, shortUrl string, fallbackUrl string, expiry time.Duration) error {
+	if fallbackUrl == "" {
+		return Get().Del(ctx, fallbackKey(shortUrl)).Err()
+	}
+	return Get().Set(ctx, fallbackKey(shortUrl), fallbackUrl, fallbackExpiry(expiry)).Err()
+}
+
+// Returns the fallback url of a short url, empty if it has none
+func GetFallback(ctx context.Context, shortUrl string) (string, error) {
+	fallbackUrl, err := Get().Get(ctx, fallbackKey(shortUrl)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return fallbackUrl, err
+}
+
+// Removes the fallback url of a short url that a url checker flagged.
+// Background jobs pass their own client, so they are not affected by the request handlers.
+func DeleteFallback(ctx context.Context, client *redis.Client, shortUrl string) error {
+	return client.Del(ctx, fallbackKey(shortUrl)).Err()
+}
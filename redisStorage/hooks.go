@@ -0,0 +1,96 @@
+package redisStorage
+
+import (
+	"context"
+	"time"
+
+	"ilmavridis/url-shortener/metrics"
+	"ilmavridis/url-shortener/tracing"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type startTimeKey struct{}
+
+// Records the latency and the errors of every redis command
+type metricsHook struct{}
+
+func (metricsHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startTimeKey{}, time.Now()), nil
+}
+
+func (metricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	observe(ctx, cmd.Name(), []redis.Cmder{cmd})
+	return nil
+}
+
+func (metricsHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startTimeKey{}, time.Now()), nil
+}
+
+func (metricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	observe(ctx, "pipeline", cmds)
+	return nil
+}
+
+func observe(ctx context.Context, name string, cmds []redis.Cmder) {
+	if start, ok := ctx.Value(startTimeKey{}).(time.Time); ok {
+		metrics.RedisDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}
+
+	for _, cmd := range cmds {
+		// A missing key is a valid answer, not a failure
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			metrics.RedisErrors.WithLabelValues(cmd.Name()).Inc()
+		}
+	}
+}
+
+// Creates a child span of the request span for every redis command
+type tracingHook struct{}
+
+func (tracingHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = startSpan(ctx, "redis "+cmd.Name())
+	return ctx, nil
+}
+
+func (tracingHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endSpan(ctx, []redis.Cmder{cmd})
+	return nil
+}
+
+func (tracingHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	ctx, _ = startSpan(ctx, "redis pipeline")
+	return ctx, nil
+}
+
+func (tracingHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	endSpan(ctx, cmds)
+	return nil
+}
+
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis),
+	)
+}
+
+func endSpan(ctx context.Context, cmds []redis.Cmder) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	names := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		// Only the command names are recorded, the arguments may contain user data
+		names = append(names, cmd.Name())
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.SetAttributes(semconv.DBOperationKey.StringSlice(names))
+}
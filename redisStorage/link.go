@@ -0,0 +1,223 @@
+package redisStorage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Link holds the metadata stored next to a short url.
+// The long url itself is still stored under the key of the short url, see LinkKey.
+type Link struct {
+	CreatedAt      time.Time     `json:"created_at"`
+	OwnerTokenHash string        `json:"owner_token_hash,omitempty"`
+	Owner          string        `json:"owner,omitempty"` // Principal that created the short url
+	CreatedBy      string        `json:"created_by,omitempty"`
+	Workspace      string        `json:"workspace,omitempty"`
+	Expiry         time.Duration `json:"expiry,omitempty"`        // Ttl that is reset on every use, 0 means the redis.expiry of the configuration
+	Disabled       bool          `json:"disabled,omitempty"`      // Disabled short urls don't redirect
+	Threat         string        `json:"threat,omitempty"`        // Why a url checker flagged the url, e.g. MALWARE
+	PasswordHash   string        `json:"password_hash,omitempty"` // Bcrypt hash of the password needed to resolve the short url
+	MaxClicks      int64         `json:"max_clicks,omitempty"`    // Clicks after which the short url stops redirecting, 0 means unlimited
+	ActiveFrom     *time.Time    `json:"active_from,omitempty"`   // The short url doesn't redirect before it
+	ActiveUntil    *time.Time    `json:"active_until,omitempty"`  // The short url is gone after it
+	Passthrough    *Passthrough  `json:"passthrough,omitempty"`
+
+	DeviceRules  map[string]string `json:"device_rules,omitempty"`  // Destinations by device class of the client, the long url is the default
+	CountryRules map[string]string `json:"country_rules,omitempty"` // Destinations by country of the client, the long url is the default
+
+	LanguageRules map[string]string `json:"language_rules,omitempty"` // Destinations by language of the client, the long url is the default
+
+	Variants []Variant `json:"variants,omitempty"` // Destinations that split the traffic of the short url
+
+	OpenGraph *OpenGraph `json:"open_graph,omitempty"` // Card that link unfurlers show instead of the one of the destination
+}
+
+// Passthrough appends parts of the request to the url that a short url redirects to
+type Passthrough struct {
+	Query bool   `json:"query,omitempty"` // Appends the query string of the request
+	Merge string `json:"merge,omitempty"` // Parameters in both urls: "incoming" (default) replaces them, "destination" keeps them, "append" keeps both
+	Path  bool   `json:"path,omitempty"`  // Appends the path segments after the short url
+}
+
+// Variant is one of the destinations that a short url splits its traffic across
+type Variant struct {
+	Name   string `json:"name"` // Stored in the cookie of the clients, so they keep getting the same variant
+	Url    string `json:"url"`
+	Weight int64  `json:"weight"` // Share of the traffic, relative to the weights of the other variants
+}
+
+// OpenGraph is served to the crawlers of chats and social networks that unfurl a short url
+type OpenGraph struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"` // Absolute url of the image of the card
+}
+
+func linkKey(shortUrl string) string {
+	return dataKey("link:", shortUrl)
+}
+
+// Stores the metadata of a short url with the same ttl as the short url
+func SaveLink(ctx context.Context, shortUrl string, link Link, expiry time.Duration) error {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+
+	return Get().Set(ctx, linkKey(shortUrl), data, expiry).Err()
+}
+
+// Returns the metadata of a short url.
+// Short urls created before metadata was introduced return an empty Link.
+func GetLink(ctx context.Context, shortUrl string) (Link, error) {
+	var link Link
+
+	data, err := Get().Get(ctx, linkKey(shortUrl)).Bytes()
+	if err == redis.Nil {
+		return link, nil
+	} else if err != nil {
+		return link, err
+	}
+
+	err = json.Unmarshal(data, &link)
+	return link, err
+}
+
+// Deletes a short url and everything stored for it
+func DeleteLink(ctx context.Context, shortUrl string) error {
+	return Get().Del(ctx, shortUrl, shortUrlIndexKey(ShortUrlOf(shortUrl)), linkKey(shortUrl), clicksKey(shortUrl), passwordFailuresKey(shortUrl), clicksLeftKey(shortUrl), fallbackKey(shortUrl), variantClicksKey(shortUrl), previewKey(shortUrl)).Err()
+}
+
+// Resets the ttl of everything stored for a short url
+func ExpireLink(ctx context.Context, shortUrl string, link Link, expiry time.Duration) error {
+	pipe := Get().TxPipeline()
+	pipe.Expire(ctx, linkKey(shortUrl), expiry)
+	pipe.Expire(ctx, clicksKey(shortUrl), expiry)
+	pipe.Expire(ctx, clicksLeftKey(shortUrl), expiry)
+	pipe.Expire(ctx, variantClicksKey(shortUrl), expiry)
+	pipe.Expire(ctx, previewKey(shortUrl), expiry)
+	pipe.Expire(ctx, fallbackKey(shortUrl), fallbackExpiry(expiry))
+	pipe.Expire(ctx, shortUrlIndexKey(ShortUrlOf(shortUrl)), fallbackExpiry(expiry))
+	for _, key := range linkQuotaKeys(link) {
+		pipe.ZAddXX(ctx, quotaLinksKey(key), &redis.Z{Score: expiresAt(expiry), Member: ShortUrlOf(shortUrl)})
+	}
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// ScannedLink holds the urls of a short url that ScanLinks returns to be checked
+type ScannedLink struct {
+	Url          string   // Empty if the short url is already disabled
+	Destinations []string // Urls of the device, country and language rules and of the variants, none if the short url is already disabled
+	FallbackUrl  string   // Empty if the short url has no fallback url
+}
+
+// Returns the urls of the rules and variants of a short url, the other destinations than its url
+func (l Link) destinations() []string {
+	var urls []string
+	for _, rules := range []map[string]string{l.DeviceRules, l.CountryRules, l.LanguageRules} {
+		for _, destination := range rules {
+			urls = append(urls, destination)
+		}
+	}
+	for _, variant := range l.Variants {
+		urls = append(urls, variant.Url)
+	}
+	return urls
+}
+
+// Returns the short urls and the urls to check, a page of a SCAN over all keys.
+// Disabled short urls still redirect to their fallback url, so only their fallback url is returned.
+// Background jobs pass their own client, so they are not affected by the request handlers.
+func ScanLinks(ctx context.Context, client *redis.Client, cursor uint64, count int64) (map[string]ScannedLink, uint64, error) {
+	// Short urls created before metadata was introduced have none, so the short urls themselves are scanned
+	keys, next, err := client.ScanType(ctx, cursor, "*", count, "string").Result()
+	if err != nil {
+		return nil, next, err
+	}
+
+	var shortUrls, metadataKeys, fallbackKeys []string
+	for _, key := range keys {
+		if isLinkKey(key) {
+			shortUrls = append(shortUrls, key)
+			metadataKeys = append(metadataKeys, linkKey(key))
+			fallbackKeys = append(fallbackKeys, fallbackKey(key))
+		}
+	}
+	if len(shortUrls) == 0 {
+		return nil, next, nil
+	}
+
+	pipe := client.Pipeline()
+	longUrls := pipe.MGet(ctx, shortUrls...)
+	metadata := pipe.MGet(ctx, metadataKeys...)
+	fallbackUrls := pipe.MGet(ctx, fallbackKeys...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, next, err
+	}
+
+	links := map[string]ScannedLink{}
+	for i, longUrl := range longUrls.Val() {
+		data, _ := metadata.Val()[i].(string)
+		var link Link
+		json.Unmarshal([]byte(data), &link)
+
+		// Skips short urls that expired meanwhile
+		s, ok := longUrl.(string)
+		if !ok {
+			continue
+		}
+
+		var scanned ScannedLink
+		if !link.Disabled {
+			scanned.Url = s
+			scanned.Destinations = link.destinations()
+		}
+		scanned.FallbackUrl, _ = fallbackUrls.Val()[i].(string)
+		if scanned.Url != "" || scanned.FallbackUrl != "" {
+			links[shortUrls[i]] = scanned
+		}
+	}
+
+	return links, next, nil
+}
+
+// Disables a short url that a url checker flagged, keeping its ttl
+func DisableLink(ctx context.Context, client *redis.Client, shortUrl string, threat string) error {
+	var link Link
+	var expiry time.Duration = redis.KeepTTL
+
+	data, err := client.Get(ctx, linkKey(shortUrl)).Bytes()
+	if err == redis.Nil {
+		// Short urls created before metadata was introduced get it, with the ttl of the short url
+		ttl, err := client.PTTL(ctx, shortUrl).Result()
+		if err != nil {
+			return err
+		}
+		if ttl == -2 {
+			// Expired meanwhile
+			return nil
+		}
+		expiry = 0
+		if ttl > 0 {
+			expiry = ttl
+		}
+	} else if err != nil {
+		return err
+	} else if err := json.Unmarshal(data, &link); err != nil {
+		return err
+	}
+
+	link.Disabled = true
+	link.Threat = threat
+	data, err = json.Marshal(link)
+	if err != nil {
+		return err
+	}
+
+	return client.Set(ctx, linkKey(shortUrl), data, expiry).Err()
+}
@@ -0,0 +1,14 @@
+package redisStorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Acquires a lock that expires after the ttl, so that only one replica runs a background job.
+// The boolean is false if another replica holds the lock.
+func TryLock(ctx context.Context, client *redis.Client, name string, ttl time.Duration) (bool, error) {
+	return client.SetNX(ctx, "lock:"+name, time.Now().UTC().Format(time.RFC3339), ttl).Result()
+}
@@ -0,0 +1,45 @@
+package redisStorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Uses one of the remaining clicks of a short url. Concurrent clicks can't use the same one.
+// Returns the clicks left after this one, or -1 if there were none left.
+var useClick = redis.NewScript(`
+local remaining = tonumber(redis.call("GET", KEYS[1]) or "0")
+if remaining <= 0 then
+	return -1
+end
+return redis.call("DECR", KEYS[1])
+`)
+
+func clicksLeftKey(shortUrl string) string {
+	return dataKey("clicks-left:", shortUrl)
+}
+
+// Sets the clicks left of a short url with a click limit
+func SetClicksLeft(ctx context.Context, shortUrl string, clicks int64, expiry time.Duration) error {
+	return Get().Set(ctx, clicksLeftKey(shortUrl), clicks, expiry).Err()
+}
+
+// Returns the clicks left of a short url with a click limit
+func GetClicksLeft(ctx context.Context, shortUrl string) (int64, error) {
+	clicks, err := Get().Get(ctx, clicksLeftKey(shortUrl)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return clicks, err
+}
+
+// Uses a click of a short url with a click limit. It returns false if no clicks are left.
+func UseClick(ctx context.Context, shortUrl string) (bool, error) {
+	left, err := useClick.Run(ctx, Get(), []string{clicksLeftKey(shortUrl)}).Int64()
+	if err != nil {
+		return false, err
+	}
+	return left >= 0, nil
+}
@@ -0,0 +1,86 @@
+package redisStorage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Short urls of a workspace are stored in its namespace: the url at workspace:<id>:<short> and the rest
+// of its data at e.g. workspace:<id>:link:<short>. Short urls without a workspace keep the keys they had
+// before workspaces, <short> and link:<short>. Short urls can't contain a colon, so the keys are unambiguous.
+// The shortUrl of the other functions of the package is this key.
+func LinkKey(workspace string, shortUrl string) string {
+	if workspace == "" {
+		return shortUrl
+	}
+	return workspaceKey(workspace) + ":" + shortUrl
+}
+
+// Reports if a key is the key of a short url returned by LinkKey, not one of its data or of anything else
+func isLinkKey(key string) bool {
+	parts := strings.Split(key, ":")
+	return len(parts) == 1 || (len(parts) == 3 && parts[0] == "workspace")
+}
+
+// Returns the key of some data of a short url, in the namespace of the key of the short url
+func dataKey(prefix string, key string) string {
+	i := strings.LastIndex(key, ":")
+	return key[:i+1] + prefix + key[i+1:]
+}
+
+// Returns the short url of a key returned by LinkKey
+func ShortUrlOf(key string) string {
+	return key[strings.LastIndex(key, ":")+1:]
+}
+
+// Short urls share the paths of the service, so every short url is claimed in one index with its workspace
+func shortUrlIndexKey(shortUrl string) string {
+	return "short:" + shortUrl
+}
+
+// Claims a short url for a workspace, unless a short url with the same name exists.
+// Claims of expired short urls are taken over. Short urls created before the index have no claim,
+// so their key without a workspace is checked too.
+var claimShortUrl = redis.NewScript(`
+local workspace = redis.call("GET", KEYS[1])
+if workspace then
+	local key = ARGV[2]
+	if workspace ~= "" then
+		key = "workspace:" .. workspace .. ":" .. ARGV[2]
+	end
+	if redis.call("EXISTS", key) == 1 then
+		return 0
+	end
+elseif redis.call("EXISTS", KEYS[2]) == 1 then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[3])
+return 1
+`)
+
+// Claims a short url for a workspace. It returns false if the short url is taken.
+// The claim lives as long as the fallback url of the short url, so ResolveKey finds it after the short url expired.
+func ClaimShortUrl(ctx context.Context, workspace string, shortUrl string, expiry time.Duration) (bool, error) {
+	claimed, err := claimShortUrl.Run(ctx, Get(), []string{shortUrlIndexKey(shortUrl), shortUrl}, workspace, shortUrl, fallbackExpiry(expiry).Milliseconds()).Int()
+	return claimed == 1, err
+}
+
+// Releases the claim of a short url that was not created, so its name can be taken again
+func ReleaseShortUrl(ctx context.Context, shortUrl string) error {
+	return Get().Del(ctx, shortUrlIndexKey(shortUrl)).Err()
+}
+
+// Returns the key of a short url, in the namespace of the workspace that claimed it.
+// Short urls without a claim, like those created before the index, have the key without a workspace.
+func ResolveKey(ctx context.Context, shortUrl string) (string, error) {
+	workspace, err := Get().Get(ctx, shortUrlIndexKey(shortUrl)).Result()
+	if err == redis.Nil {
+		return shortUrl, nil
+	} else if err != nil {
+		return "", err
+	}
+	return LinkKey(workspace, shortUrl), nil
+}
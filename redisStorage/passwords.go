@@ -0,0 +1,51 @@
+package redisStorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Counts a wrong password. The count expires after the lockout period, which starts again
+// when the maximum attempts are reached, so a locked short url stays locked for the whole period.
+var passwordFailure = redis.NewScript(`
+local failures = redis.call("INCR", KEYS[1])
+if failures == 1 or failures >= tonumber(ARGV[2]) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return failures
+`)
+
+func passwordFailuresKey(shortUrl string) string {
+	return dataKey("password-failures:", shortUrl)
+}
+
+// Returns how long a short url stays locked after maxAttempts wrong passwords, 0 if it isn't locked
+func PasswordLockout(ctx context.Context, shortUrl string, maxAttempts int64) (time.Duration, error) {
+	failures, err := Get().Get(ctx, passwordFailuresKey(shortUrl)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if failures < maxAttempts {
+		return 0, nil
+	}
+
+	ttl, err := Get().PTTL(ctx, passwordFailuresKey(shortUrl)).Result()
+	if err != nil || ttl < 0 {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+// Counts a wrong password for a short url and returns the wrong passwords within the lockout period
+func PasswordFailed(ctx context.Context, shortUrl string, maxAttempts int64, lockout time.Duration) (int64, error) {
+	return passwordFailure.Run(ctx, Get(), []string{passwordFailuresKey(shortUrl)}, lockout.Milliseconds(), maxAttempts).Int64()
+}
+
+// Forgets the wrong passwords of a short url after the right one was given
+func ResetPasswordFailures(ctx context.Context, shortUrl string) error {
+	return Get().Del(ctx, passwordFailuresKey(shortUrl)).Err()
+}
@@ -0,0 +1,102 @@
+package redisStorage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Preview is what the preview page of a short url shows about its destination
+type Preview struct {
+	Url       string    `json:"url"` // The long url that was fetched, a changed url needs a new preview
+	Title     string    `json:"title,omitempty"`
+	Favicon   string    `json:"favicon,omitempty"` // Data url of the icon of the page
+	Error     string    `json:"error,omitempty"`   // Why the page could not be fetched
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// Short urls whose destination has to be fetched for their preview
+const previewQueueKey = "preview-queue"
+
+func previewKey(shortUrl string) string {
+	return dataKey("preview:", shortUrl)
+}
+
+// Queues a short url, so the background job fetches the title and favicon of its destination
+func QueuePreview(ctx context.Context, shortUrl string) error {
+	return Get().SAdd(ctx, previewQueueKey, shortUrl).Err()
+}
+
+// Takes up to count short urls from the queue. Every short url is only taken by one replica.
+func NextPreviews(ctx context.Context, client *redis.Client, count int64) ([]string, error) {
+	return client.SPopN(ctx, previewQueueKey, count).Result()
+}
+
+// Queues short urls that were taken from the queue again, e.g. when the job failed before fetching them
+func RequeuePreviews(ctx context.Context, client *redis.Client, shortUrls []string) error {
+	members := make([]interface{}, len(shortUrls))
+	for i, shortUrl := range shortUrls {
+		members[i] = shortUrl
+	}
+	return client.SAdd(ctx, previewQueueKey, members...).Err()
+}
+
+// Returns the url that is fetched for the preview of a short url.
+// The boolean is false if the short url expired meanwhile or is disabled, so its destination is not fetched.
+func PreviewDestination(ctx context.Context, client *redis.Client, shortUrl string) (string, bool, error) {
+	pipe := client.Pipeline()
+	longUrl := pipe.Get(ctx, shortUrl)
+	metadata := pipe.Get(ctx, linkKey(shortUrl))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return "", false, err
+	}
+	if longUrl.Err() == redis.Nil {
+		return "", false, nil
+	}
+
+	// Short urls created before metadata was introduced have none
+	var link Link
+	if data, err := metadata.Bytes(); err == nil {
+		if err := json.Unmarshal(data, &link); err != nil {
+			return "", false, err
+		}
+	}
+	if link.Disabled {
+		return "", false, nil
+	}
+
+	return longUrl.Val(), true, nil
+}
+
+// Stores the preview of a short url with the ttl of the short url.
+// Short urls that expired meanwhile are skipped.
+func SavePreview(ctx context.Context, client *redis.Client, shortUrl string, preview Preview) error {
+	ttl, err := client.TTL(ctx, shortUrl).Result()
+	if err != nil || ttl <= 0 {
+		return err
+	}
+
+	data, err := json.Marshal(preview)
+	if err != nil {
+		return err
+	}
+
+	return client.Set(ctx, previewKey(shortUrl), data, ttl).Err()
+}
+
+// Returns the preview of a short url. The boolean is false if it has not been fetched yet.
+func GetPreview(ctx context.Context, shortUrl string) (Preview, bool, error) {
+	var preview Preview
+
+	data, err := Get().Get(ctx, previewKey(shortUrl)).Bytes()
+	if err == redis.Nil {
+		return preview, false, nil
+	} else if err != nil {
+		return preview, false, err
+	}
+
+	err = json.Unmarshal(data, &preview)
+	return preview, err == nil, err
+}
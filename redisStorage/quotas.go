@@ -0,0 +1,188 @@
+package redisStorage
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Quota limits the short urls of an api key, a user or a workspace
+type Quota struct {
+	Owner          string `json:"owner"`             // e.g. apikey:<id>, user:<subject> or workspace:<id>
+	MaxLinks       int64  `json:"max_links"`         // Active short urls, 0 means unlimited
+	MaxLinksPerDay int64  `json:"max_links_per_day"` // Short urls created per day (UTC), 0 means unlimited
+
+	key string // Prefix of the redis keys of the quota
+}
+
+// QuotaUsage is the current usage of a quota
+type QuotaUsage struct {
+	Quota
+	ActiveLinks int64     `json:"active_links"`
+	LinksToday  int64     `json:"links_today"`
+	DayResetsAt time.Time `json:"day_resets_at"`
+}
+
+// QuotaExceeded is returned when a short url would exceed a quota
+type QuotaExceeded struct {
+	Quota Quota
+	Limit string // max_links or max_links_per_day
+	Max   int64
+}
+
+func (e *QuotaExceeded) Error() string {
+	return "quota " + e.Limit + " of " + e.Quota.Owner + " exceeded"
+}
+
+// The quota of a principal, identified by its id
+func PrincipalQuota(principalID string, maxLinks int64, maxLinksPerDay int64) Quota {
+	return Quota{Owner: principalID, MaxLinks: maxLinks, MaxLinksPerDay: maxLinksPerDay, key: principalQuotaKey(principalID)}
+}
+
+// The quota of a workspace
+func WorkspaceQuota(ws Workspace) Quota {
+	return Quota{Owner: workspaceKey(ws.ID), MaxLinks: ws.MaxLinks, MaxLinksPerDay: ws.MaxLinksPerDay, key: principalQuotaKey(workspaceKey(ws.ID))}
+}
+
+// Keys of quotas are outside of the namespaces of short urls, so no short url can be stored over them
+func principalQuotaKey(principalID string) string {
+	return "quota:" + principalID
+}
+
+// Sorted set of the short urls counted by a quota, scored by the time they expire
+func quotaLinksKey(key string) string {
+	return key + ":links"
+}
+
+// Number of short urls created on a day, kept for two days
+func quotaDayKey(key string, day time.Time) string {
+	return key + ":links:" + day.Format("2006-01-02")
+}
+
+// Keys of the quotas that count a short url
+func linkQuotaKeys(link Link) []string {
+	var keys []string
+	if link.Owner != "" {
+		keys = append(keys, principalQuotaKey(link.Owner))
+	}
+	if link.Workspace != "" {
+		keys = append(keys, principalQuotaKey(workspaceKey(link.Workspace)))
+	}
+	return keys
+}
+
+// Checks all quotas and counts the short url in them only if none is exceeded,
+// so concurrent requests can't go over a quota
+var reserveLink = redis.NewScript(`
+local now = ARGV[1]
+local quotas = #KEYS / 2
+for i = 1, quotas do
+	redis.call("ZREMRANGEBYSCORE", KEYS[2 * i - 1], "-inf", "(" .. now)
+	local maxLinks = tonumber(ARGV[3 + 2 * i])
+	local maxLinksPerDay = tonumber(ARGV[4 + 2 * i])
+	if maxLinks > 0 and redis.call("ZCARD", KEYS[2 * i - 1]) >= maxLinks then
+		return {i, "max_links"}
+	end
+	if maxLinksPerDay > 0 and tonumber(redis.call("GET", KEYS[2 * i]) or "0") >= maxLinksPerDay then
+		return {i, "max_links_per_day"}
+	end
+end
+for i = 1, quotas do
+	redis.call("ZADD", KEYS[2 * i - 1], ARGV[2], ARGV[3])
+	redis.call("INCR", KEYS[2 * i])
+	redis.call("EXPIRE", KEYS[2 * i], ARGV[4])
+end
+return {0, ""}
+`)
+
+// Counts a new short url in the quotas. A *QuotaExceeded error is returned if one of them is exceeded.
+func ReserveLink(ctx context.Context, quotas []Quota, shortUrl string, expiry time.Duration) error {
+	if len(quotas) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	keys := make([]string, 0, 2*len(quotas))
+	args := []interface{}{now.Unix(), scoreString(expiresAt(expiry)), shortUrl, int64((48 * time.Hour).Seconds())}
+	for _, quota := range quotas {
+		keys = append(keys, quotaLinksKey(quota.key), quotaDayKey(quota.key, now))
+		args = append(args, quota.MaxLinks, quota.MaxLinksPerDay)
+	}
+
+	values, err := reserveLink.Run(ctx, Get(), keys, args...).Slice()
+	if err != nil {
+		return err
+	}
+	exceeded, _ := values[0].(int64)
+	if exceeded == 0 {
+		return nil
+	}
+
+	quota := quotas[exceeded-1]
+	limit, _ := values[1].(string)
+	max := quota.MaxLinks
+	if limit == "max_links_per_day" {
+		max = quota.MaxLinksPerDay
+	}
+	return &QuotaExceeded{Quota: quota, Limit: limit, Max: max}
+}
+
+// Stops counting a deleted short url as active. It still counts for the day it was created.
+func ReleaseLink(ctx context.Context, shortUrl string, link Link) error {
+	pipe := Get().TxPipeline()
+	for _, key := range linkQuotaKeys(link) {
+		pipe.ZRem(ctx, quotaLinksKey(key), shortUrl)
+	}
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// Returns the current usage of the quotas
+func GetQuotaUsage(ctx context.Context, quotas []Quota) ([]QuotaUsage, error) {
+	now := time.Now().UTC()
+	min := "(" + strconv.FormatInt(now.Unix(), 10)
+
+	pipe := Get().TxPipeline()
+	activeLinks := make([]*redis.IntCmd, len(quotas))
+	linksToday := make([]*redis.StringCmd, len(quotas))
+	for i, quota := range quotas {
+		pipe.ZRemRangeByScore(ctx, quotaLinksKey(quota.key), "-inf", min)
+		activeLinks[i] = pipe.ZCard(ctx, quotaLinksKey(quota.key))
+		linksToday[i] = pipe.Get(ctx, quotaDayKey(quota.key, now))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	usage := make([]QuotaUsage, len(quotas))
+	for i, quota := range quotas {
+		today, _ := linksToday[i].Int64()
+		usage[i] = QuotaUsage{
+			Quota:       quota,
+			ActiveLinks: activeLinks[i].Val(),
+			LinksToday:  today,
+			DayResetsAt: now.Truncate(24 * time.Hour).Add(24 * time.Hour),
+		}
+	}
+
+	return usage, nil
+}
+
+// Keys without an expiry are never removed from the quota
+func expiresAt(expiry time.Duration) float64 {
+	if expiry <= 0 {
+		return math.Inf(1)
+	}
+	return float64(time.Now().Add(expiry).Unix())
+}
+
+func scoreString(score float64) string {
+	if math.IsInf(score, 1) {
+		return "+inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
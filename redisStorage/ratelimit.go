@@ -0,0 +1,78 @@
+package redisStorage
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Refills the bucket for the time since the last request and takes a token if there is one.
+// The clock of redis is used, so all replicas of the service share the same buckets.
+var tokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// RateLimitResult is the state of a token bucket after a request
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int64         // Size of the bucket
+	Remaining  int64         // Requests that can still be sent at once
+	RetryAfter time.Duration // Until the next request is allowed, 0 if it is allowed now
+	Reset      time.Duration // Until the bucket is full again
+}
+
+// Takes a token from the bucket with the given key.
+// The bucket holds up to burst tokens and is refilled with perMinute tokens every minute.
+func TakeToken(ctx context.Context, key string, perMinute float64, burst int64) (RateLimitResult, error) {
+	rate := perMinute / 60 // tokens per second
+	result := RateLimitResult{Limit: burst}
+
+	values, err := tokenBucket.Run(ctx, Get(), []string{"ratelimit:" + key}, rate, burst).Slice()
+	if err != nil {
+		return result, err
+	}
+	allowed, _ := values[0].(int64)
+	tokensString, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensString, 64)
+	if err != nil {
+		return result, err
+	}
+
+	result.Allowed = allowed == 1
+	result.Remaining = int64(math.Floor(tokens))
+	result.Reset = secondsDuration((float64(burst) - tokens) / rate)
+	if !result.Allowed {
+		result.RetryAfter = secondsDuration((1 - tokens) / rate)
+	}
+
+	return result, nil
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
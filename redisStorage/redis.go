@@ -2,6 +2,7 @@ package redisStorage
 
 import (
 	"context"
+	"sync"
 
 	"ilmavridis/url-shortener/config"
 
@@ -9,26 +10,57 @@ import (
 )
 
 var Ctx = context.Background()
-var redisClient *redis.Client
 
+var (
+	redisClient *redis.Client
+	clientErr   error
+	clientOnce  sync.Once
+)
+
+// Creates the client shared by the request handlers and returns the result of testing its connection.
+// It is created only once and is safe for concurrent use, so handlers must not close it.
 func CreateClient() error {
+	clientOnce.Do(func() {
+		redisClient, clientErr = NewClient()
+	})
+
+	return clientErr
+}
+
+// Returns a new connection that is not shared with the request handlers.
+// Long-running components (e.g. event publishers) use it and close it themselves.
+func NewClient() (*redis.Client, error) {
 
 	dbConf := config.Get()
 	redisConf := dbConf.Redis
 
-	redisClient = redis.NewClient(&redis.Options{
+	client := redis.NewClient(&redis.Options{
 		Addr:     redisConf.Address,
 		Password: redisConf.Pass,
 		DB:       redisConf.Database,
 	})
+	client.AddHook(metricsHook{})
 
 	// Tests connection
-	_, err := redisClient.Ping(context.Background()).Result()
+	_, err := client.Ping(context.Background()).Result()
+
+	// Added after the ping, that has no request to be traced with
+	client.AddHook(tracingHook{})
 
-	return err
+	return client, err
 }
 
-// Returns the connection created
+// Returns the shared connection, which is created on first use.
+// A connection that failed its test reconnects on the next command.
 func Get() *redis.Client {
+	CreateClient()
 	return redisClient
 }
+
+// Closes the shared connection when the service stops
+func Close() error {
+	if redisClient == nil {
+		return nil
+	}
+	return redisClient.Close()
+}
@@ -0,0 +1,36 @@
+package redisStorage
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func variantClicksKey(shortUrl string) string {
+	return dataKey("variant-clicks:", shortUrl)
+}
+
+// Returns the clicks of the variants of a short url, in the order of their names
+func VariantClicks(ctx context.Context, shortUrl string, names []string) ([]int64, error) {
+	clicks := make([]int64, len(names))
+	if len(names) == 0 {
+		return clicks, nil
+	}
+
+	values, err := Get().HMGet(ctx, variantClicksKey(shortUrl), names...).Result()
+	if err == redis.Nil {
+		return clicks, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		// Variants without clicks are missing
+		if s, ok := value.(string); ok {
+			clicks[i], _ = strconv.ParseInt(s, 10, 64)
+		}
+	}
+
+	return clicks, nil
+}
@@ -0,0 +1,92 @@
+package redisStorage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Workspace is a tenant of the service. Its api keys, users and links are isolated from other workspaces.
+type Workspace struct {
+	ID             string         `json:"id"`
+	Name           string         `json:"name"`
+	DefaultExpiry  int64          `json:"default_expiry_seconds"`  // Expiry of its short urls, 0 means the redis.expiry of the configuration
+	AllowedDomains []string       `json:"allowed_domains"`         // Domains its short urls can redirect to, empty means any domain
+	MaxLinks       int64          `json:"max_links"`               // Active short urls, 0 means unlimited
+	MaxLinksPerDay int64          `json:"max_links_per_day"`       // Short urls created per day (UTC), 0 means unlimited
+	UTMTemplates   map[string]UTM `json:"utm_templates,omitempty"` // Named UTM parameters that its short urls can use
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+// UTM holds the UTM parameters that are added to the urls of marketing campaigns
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// Returns the expiry of the short urls of the workspace, 0 if it uses the configured one
+func (ws Workspace) Expiry() time.Duration {
+	return time.Duration(ws.DefaultExpiry) * time.Second
+}
+
+// Set of the ids of all workspaces
+const workspacesIndex = "workspaces"
+
+// Everything stored for a workspace is namespaced under workspace:<id>
+func workspaceKey(id string) string {
+	return "workspace:" + id
+}
+
+func SaveWorkspace(ctx context.Context, ws Workspace) error {
+	data, err := json.Marshal(ws)
+	if err != nil {
+		return err
+	}
+
+	pipe := Get().TxPipeline()
+	pipe.Set(ctx, workspaceKey(ws.ID), data, 0)
+	pipe.SAdd(ctx, workspacesIndex, ws.ID)
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// Returns the workspace with the given id. The boolean is false if there is no such workspace.
+func GetWorkspace(ctx context.Context, id string) (Workspace, bool, error) {
+	var ws Workspace
+
+	data, err := Get().Get(ctx, workspaceKey(id)).Bytes()
+	if err == redis.Nil {
+		return ws, false, nil
+	} else if err != nil {
+		return ws, false, err
+	}
+
+	err = json.Unmarshal(data, &ws)
+	return ws, err == nil, err
+}
+
+func ListWorkspaces(ctx context.Context) ([]Workspace, error) {
+	ids, err := Get().SMembers(ctx, workspacesIndex).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	workspaces := make([]Workspace, 0, len(ids))
+	for _, id := range ids {
+		ws, found, err := GetWorkspace(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			workspaces = append(workspaces, ws)
+		}
+	}
+
+	return workspaces, nil
+}
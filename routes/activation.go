@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/middleware"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Checks the activation window of a new short url
+func validateActiveWindow(from *time.Time, until *time.Time) error {
+	if until == nil {
+		return nil
+	}
+	if !until.After(time.Now()) {
+		return errors.New("active_until must be in the future")
+	}
+	if from != nil && !until.After(*from) {
+		return errors.New("active_until must be after active_from")
+	}
+	return nil
+}
+
+// Checks if a short url is within its activation window. Before it, clients are redirected to the
+// configured pending url or get the not yet active page, after it the short url is gone.
+// On failure the response is written and false is returned.
+func checkActiveWindow(w http.ResponseWriter, r *http.Request, key string, link redisStorage.Link) bool {
+	now := time.Now()
+
+	if link.ActiveFrom != nil && now.Before(*link.ActiveFrom) {
+		if pendingUrl := config.Get().Activation.PendingUrl; pendingUrl != "" {
+			w.Header().Set("Cache-Control", "no-store")
+			http.Redirect(w, r, pendingUrl, http.StatusFound)
+			return false
+		}
+
+		if wantsHTML(r) {
+			renderPage(w, r, http.StatusForbidden, "pending.html", map[string]interface{}{
+				"Short":      redisStorage.ShortUrlOf(key),
+				"ActiveFrom": link.ActiveFrom.UTC().Format(time.RFC1123),
+			})
+			return false
+		}
+		middleware.JSONErrorWith(w, r, http.StatusForbidden, "short url is not active yet", map[string]interface{}{
+			"active_from": link.ActiveFrom,
+		})
+		return false
+	}
+
+	if link.ActiveUntil != nil && !now.Before(*link.ActiveUntil) {
+		if redirectToFallback(w, r, key) {
+			return false
+		}
+		jsonError(w, r, http.StatusGone, "short url is no longer active")
+		return false
+	}
+
+	return true
+}
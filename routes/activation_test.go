@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActiveWindow(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	client := randomTestIP() + ":41234"
+	defer deleteTestLink("active0")
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"active0","active_until":"`+past+`"}`, nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	from := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	until := from.Add(24 * time.Hour)
+	body := fmt.Sprintf(`{"url":"http://www.testsite1.com","short":"active0","active_from":"%s","active_until":"%s"}`,
+		from.Format(time.RFC3339), until.Format(time.RFC3339))
+	rr = serveTestRequest(handler, "POST", "/short", body, nil)
+	var created response
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// The short url doesn't expire before it goes live
+	if created.ExpiresIn <= 24*60*60 {
+		t.Errorf("Error: Short url expires before it is active: %v", created.ExpiresIn)
+	}
+
+	rr = clickTestUrl(handler, "active0", client, nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	rr = serveTestRequest(handler, "GET", "/active0", "", map[string]string{"Accept": "text/html"})
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "not active yet") {
+		t.Errorf("Error: Expected the not yet active page, got %v %q", rr.Code, rr.Body.String())
+	}
+
+	// Updating the short url before it goes live keeps it until then
+	rr = serveTestRequest(handler, "PATCH", "/short/active0", `{"url":"http://www.testsite2.com"}`, map[string]string{"X-Owner-Token": created.OwnerToken})
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var updated response
+	json.Unmarshal(rr.Body.Bytes(), &updated)
+	if updated.ExpiresIn <= 24*60*60 {
+		t.Errorf("Error: Updated short url expires before it is active: %v", updated.ExpiresIn)
+	}
+	if ttl := redisStorage.Get().TTL(redisStorage.Ctx, "active0").Val(); ttl <= 24*time.Hour {
+		t.Errorf("Error: Updated short url expires before it is active: %v", ttl)
+	}
+
+	// Moves the window to the past
+	link, _ := redisStorage.GetLink(redisStorage.Ctx, "active0")
+	start, end := time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour)
+	link.ActiveFrom, link.ActiveUntil = &start, &end
+	redisStorage.SaveLink(redisStorage.Ctx, "active0", link, time.Hour)
+
+	rr = clickTestUrl(handler, "active0", client, nil)
+	if rr.Code != http.StatusGone {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusGone)
+	}
+
+	// And to now. The redirect is not cached, so it stops when the window ends
+	end = time.Now().Add(time.Hour)
+	redisStorage.SaveLink(redisStorage.Ctx, "active0", link, time.Hour)
+
+	rr = clickTestUrl(handler, "active0", client, nil)
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusSeeOther)
+	}
+}
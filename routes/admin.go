@@ -0,0 +1,159 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/auth"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type apiKeyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	RateLimit int64    `json:"rate_limit"` // Requests per minute, 0 means unlimited
+	Workspace string   `json:"workspace"`
+
+	MaxLinks       int64 `json:"max_links"`         // Active short urls, 0 means unlimited
+	MaxLinksPerDay int64 `json:"max_links_per_day"` // Short urls created per day, 0 means unlimited
+}
+
+type apiKeyResponse struct {
+	Key string `json:"key,omitempty"` // Only returned when the api key is issued
+	redisStorage.APIKey
+}
+
+// Issues a new api key. The key is only returned in this response, just its hash is stored.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	body := new(apiKeyRequest)
+	if !decodeJSON(w, r, body) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if body.Name == "" {
+		jsonError(w, r, http.StatusBadRequest, "name is required")
+		return
+	}
+	if len(body.Scopes) == 0 {
+		jsonError(w, r, http.StatusBadRequest, "at least one scope is required")
+		return
+	}
+	for _, scope := range body.Scopes {
+		if !auth.ValidScope(scope) {
+			jsonError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown scope %s", scope))
+			return
+		}
+	}
+	if body.RateLimit < 0 {
+		jsonError(w, r, http.StatusBadRequest, "rate_limit can't be negative")
+		return
+	}
+	if body.MaxLinks < 0 || body.MaxLinksPerDay < 0 {
+		jsonError(w, r, http.StatusBadRequest, "quotas can't be negative")
+		return
+	}
+
+	// Admins of a workspace can only issue api keys for their own workspace
+	principal := auth.FromContext(r.Context())
+	if principal.Workspace != "" {
+		if body.Workspace != "" && body.Workspace != principal.Workspace {
+			jsonError(w, r, http.StatusForbidden, "api keys can only be issued for your own workspace")
+			return
+		}
+		body.Workspace = principal.Workspace
+	}
+	if _, err := loadWorkspace(r.Context(), body.Workspace); err == errWorkspaceNotFound {
+		jsonError(w, r, http.StatusBadRequest, fmt.Sprintf("workspace %s does not exist", body.Workspace))
+		return
+	} else if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	key, err := auth.GenerateAPIKey()
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "generating api key")
+		return
+	}
+
+	apiKey := redisStorage.APIKey{
+		ID:             uuid.New().String(),
+		Name:           body.Name,
+		Scopes:         body.Scopes,
+		RateLimit:      body.RateLimit,
+		Workspace:      body.Workspace,
+		MaxLinks:       body.MaxLinks,
+		MaxLinksPerDay: body.MaxLinksPerDay,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := redisStorage.SaveAPIKey(r.Context(), auth.HashToken(key), apiKey); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(apiKeyResponse{key, apiKey}); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "encoding response to json")
+		return
+	}
+
+	return
+}
+
+// Lists the api keys of the workspaces that the admin manages, without the keys themselves
+func ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	keys, err := redisStorage.ListAPIKeys(r.Context())
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	principal := auth.FromContext(r.Context())
+	visible := make([]redisStorage.APIKey, 0, len(keys))
+	for _, key := range keys {
+		if principal.AdminOf(key.Workspace) {
+			visible = append(visible, key)
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(visible); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "encoding response to json")
+		return
+	}
+
+	return
+}
+
+// Revokes an api key, requests with it are rejected immediately
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	apiKey, found, err := redisStorage.GetAPIKeyByID(r.Context(), id)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+	// Api keys of other workspaces are reported as missing
+	if !found || !auth.FromContext(r.Context()).AdminOf(apiKey.Workspace) {
+		jsonError(w, r, http.StatusNotFound, "api key not found")
+		return
+	}
+
+	if _, err := redisStorage.RevokeAPIKey(r.Context(), id); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return
+}
@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Sends a request through the router with all the middleware
+func serveTestRequest(handler http.Handler, method string, path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	// Every request comes from another client, so the tests don't share the buckets of the rate limits
+	req.RemoteAddr = randomTestIP() + ":41234"
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// Issues an api key with the admin key of the test configuration and returns the key and its id
+func issueTestAPIKey(t *testing.T, handler http.Handler, body string) (string, string) {
+	conf := config.Get()
+
+	rr := serveTestRequest(handler, "POST", "/admin/keys", body, map[string]string{"X-API-Key": conf.Auth.AdminKey})
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	var m map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &m)
+	return fmt.Sprintf("%v", m["key"]), fmt.Sprintf("%v", m["id"])
+}
+
+func TestAPIKeys(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+
+	key, id := issueTestAPIKey(t, handler, `{"name":"test","scopes":["create","manage"]}`)
+	otherKey, otherID := issueTestAPIKey(t, handler, `{"name":"other","scopes":["create","manage"]}`)
+	defer deleteTestLink("apikey0")
+
+	// Short url created with the api key
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"apikey0"}`,
+		map[string]string{"Authorization": "Bearer " + key})
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Only the api key that created it can manage it
+	rr = serveTestRequest(handler, "PATCH", "/short/apikey0", `{"url":"http://www.testsite2.com"}`,
+		map[string]string{"X-API-Key": otherKey})
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	rr = serveTestRequest(handler, "PATCH", "/short/apikey0", `{"url":"http://www.testsite2.com"}`,
+		map[string]string{"X-API-Key": key})
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// The api key can't issue other keys
+	rr = serveTestRequest(handler, "POST", "/admin/keys", `{"name":"test","scopes":["admin"]}`,
+		map[string]string{"X-API-Key": key})
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	// Revoked keys are rejected
+	conf := config.Get()
+	for _, revoke := range []string{id, otherID} {
+		rr = serveTestRequest(handler, "DELETE", "/admin/keys/"+revoke, "", map[string]string{"X-API-Key": conf.Auth.AdminKey})
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+		}
+	}
+
+	rr = serveTestRequest(handler, "DELETE", "/short/apikey0", "", map[string]string{"X-API-Key": key})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	logger.New()
+	config.Read()
+	conf := config.Get()
+	handler := New().Handler
+
+	key, id := issueTestAPIKey(t, handler, `{"name":"limited","scopes":["read-info"],"rate_limit":1}`)
+	defer serveTestRequest(handler, "DELETE", "/admin/keys/"+id, "", map[string]string{"X-API-Key": conf.Auth.AdminKey})
+
+	serveTestRequest(handler, "GET", "/info/foo123", "", map[string]string{"X-API-Key": key})
+	rr := serveTestRequest(handler, "GET", "/info/foo123", "", map[string]string{"X-API-Key": key})
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Error: No Retry-After header")
+	}
+}
+
+func TestAdminRequiresAuthentication(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+
+	rr := serveTestRequest(handler, "GET", "/admin/keys", "", nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/policy"
+
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Resolves the hosts of the tests without DNS: the listed ones to their addresses,
+// .invalid hosts to none and every other host to a public address
+type testResolver map[string][]string
+
+func (r testResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if strings.HasSuffix(host, ".invalid") {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	ips, ok := r[host]
+	if !ok {
+		ips = []string{"93.184.216.34"}
+	}
+
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func TestMain(m *testing.M) {
+	policy.SetResolver(testResolver{
+		"localhost":                {"127.0.0.1", "::1"},
+		"metadata.google.internal": {"169.254.169.254"},
+		"intranet.example.com":     {"10.1.2.3"},
+		"rebind.example.com":       {"93.184.216.34", "10.1.2.3"},
+		"internal.example.com":     {"10.20.0.5"},
+	})
+
+	os.Exit(m.Run())
+}
+
+func TestDestination(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("destination0")
+
+	tests := []struct {
+		url  string
+		code int
+		rule string
+	}{
+		{"javascript:alert(1)", http.StatusForbidden, "scheme:javascript"},
+		{"data:text/html,<script>alert(1)</script>", http.StatusForbidden, "scheme:data"},
+		{"file:///etc/passwd", http.StatusForbidden, "scheme:file"},
+		{"ftp://www.testsite1.com/file", http.StatusForbidden, "scheme:ftp"},
+		{"http://localhost:8080/admin", http.StatusForbidden, "internal:loopback"},
+		{"localhost:8080/admin", http.StatusForbidden, "internal:loopback"},
+		{"http://[::1]/", http.StatusForbidden, "internal:loopback"},
+		{"http://169.254.169.254/latest/meta-data/", http.StatusForbidden, "internal:link-local"},
+		{"http://metadata.google.internal/computeMetadata/v1/", http.StatusForbidden, "internal:link-local"},
+		{"http://100.100.100.200/latest/meta-data/", http.StatusForbidden, "internal:metadata"},
+		{"http://10.0.0.1/", http.StatusForbidden, "internal:private"},
+		{"http://intranet.example.com/", http.StatusForbidden, "internal:private"},
+		{"http://rebind.example.com/", http.StatusForbidden, "internal:private"},
+		{"http://www.testsite.invalid/", http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		rr := serveTestRequest(handler, "POST", "/short", `{"url":"`+strings.ReplaceAll(test.url, `"`, `\"`)+`"}`, nil)
+		if rr.Code != test.code {
+			t.Errorf("Error: Handler returned wrong status code for %s: got %v want %v", test.url, rr.Code, test.code)
+		}
+		if rule := policyRule(rr.Body.String()); rule != test.rule {
+			t.Errorf("Error: Wrong policy rule for %s: got %q want %q", test.url, rule, test.rule)
+		}
+	}
+
+	// Internal ranges of the configuration are allowed
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"https://internal.example.com/wiki","short":"destination0"}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/redisStorage"
+
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Device classes that the device rules of a short url can target
+const (
+	deviceIOS     = "ios"
+	deviceAndroid = "android"
+	deviceDesktop = "desktop"
+)
+
+var deviceClasses = map[string]bool{
+	deviceIOS:     true,
+	deviceAndroid: true,
+	deviceDesktop: true,
+}
+
+// Returns the device class of a user agent, or an empty one for clients that are neither
+// (bots, command line tools, other mobile platforms), which get the default destination
+func deviceClass(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		return deviceIOS
+	// Checked before desktops, Android user agents also contain Linux
+	case strings.Contains(userAgent, "Android"):
+		return deviceAndroid
+	case strings.Contains(userAgent, "Mobile"):
+		return ""
+	case strings.Contains(userAgent, "Windows NT"), strings.Contains(userAgent, "Macintosh"),
+		strings.Contains(userAgent, "X11"), strings.Contains(userAgent, "CrOS"):
+		return deviceDesktop
+	}
+	return ""
+}
+
+// Checks the device classes and the urls of device rules.
+// On failure the error response is written and false is returned.
+func validateDeviceRules(w http.ResponseWriter, r *http.Request, rules map[string]string, workspace redisStorage.Workspace) bool {
+	for _, class := range sortedRuleKeys(rules) {
+		if !deviceClasses[class] {
+			jsonError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown device class %q, use %s, %s or %s", class, deviceIOS, deviceAndroid, deviceDesktop))
+			return false
+		}
+		if !validateUrl(w, r, rules[class], workspace) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the destination of a short url for the device of the client, if one of its device rules matches
+func deviceUrl(r *http.Request, link redisStorage.Link) (string, bool) {
+	if len(link.DeviceRules) == 0 {
+		return "", false
+	}
+	destination, ok := link.DeviceRules[deviceClass(r.UserAgent())]
+	return destination, ok
+}
@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+const (
+	iPhoneUserAgent  = "Mozilla/5.0 (iPhone; CPU iPhone OS 15_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.5 Mobile/15E148 Safari/604.1"
+	androidUserAgent = "Mozilla/5.0 (Linux; Android 12; Pixel 6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/102.0.5005.78 Mobile Safari/537.36"
+	desktopUserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/102.0.5005.61 Safari/537.36"
+)
+
+func TestDeviceClass(t *testing.T) {
+	tests := map[string]string{
+		iPhoneUserAgent:  deviceIOS,
+		androidUserAgent: deviceAndroid,
+		desktopUserAgent: deviceDesktop,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/102.0.0.0 Safari/537.36": deviceDesktop,
+		"Mozilla/5.0 (Mobile; rv:48.0) Gecko/48.0 Firefox/48.0 KAIOS/2.5":                                                 "",
+		"curl/7.81.0": "",
+	}
+	for userAgent, want := range tests {
+		if got := deviceClass(userAgent); got != want {
+			t.Errorf("Error: Wrong device class of %q: got %q want %q", userAgent, got, want)
+		}
+	}
+}
+
+func TestDeviceRules(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	client := randomTestIP() + ":41234"
+	defer deleteTestLink("device0")
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"device0","device_rules":{"windows":"http://www.testsite2.com"}}`, nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"device0","device_rules":{"ios":"https://apps.apple.com/app/id1","android":"https://play.google.com/store/apps/details?id=com.example"}}`, nil)
+	var created response
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if rr.Code != http.StatusOK || len(created.DeviceRules) != 2 {
+		t.Fatalf("Error: Short url with device rules not created: %v %s", rr.Code, rr.Body.String())
+	}
+
+	tests := map[string]string{
+		iPhoneUserAgent:  "https://apps.apple.com/app/id1",
+		androidUserAgent: "https://play.google.com/store/apps/details?id=com.example",
+		desktopUserAgent: "http://www.testsite1.com",
+		"curl/7.81.0":    "http://www.testsite1.com",
+	}
+	for userAgent, want := range tests {
+		rr = clickTestUrl(handler, "device0", client, map[string]string{"User-Agent": userAgent})
+		// Redirects that depend on the client are not cached
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != want {
+			t.Errorf("Error: Wrong redirect for %q: got %v %q want %q", userAgent, rr.Code, rr.Header().Get("Location"), want)
+		}
+	}
+
+	// The rules are replaced by updates
+	rr = serveTestRequest(handler, "PATCH", "/short/device0", `{"device_rules":{"desktop":"http://www.testsite2.com"}}`, map[string]string{"X-Owner-Token": created.OwnerToken})
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	rr = serveTestRequest(handler, "GET", "/info/device0", "", nil)
+	var info response
+	json.Unmarshal(rr.Body.Bytes(), &info)
+	if len(info.DeviceRules) != 1 || info.DeviceRules[deviceDesktop] != "http://www.testsite2.com" {
+		t.Errorf("Error: Wrong device rules: got %v", info.DeviceRules)
+	}
+	if rr = clickTestUrl(handler, "device0", client, map[string]string{"User-Agent": iPhoneUserAgent}); rr.Header().Get("Location") != "http://www.testsite1.com" {
+		t.Errorf("Error: Wrong redirect: got %q want %q", rr.Header().Get("Location"), "http://www.testsite1.com")
+	}
+	if rr = clickTestUrl(handler, "device0", client, map[string]string{"User-Agent": desktopUserAgent}); rr.Header().Get("Location") != "http://www.testsite2.com" {
+		t.Errorf("Error: Wrong redirect: got %q want %q", rr.Header().Get("Location"), "http://www.testsite2.com")
+	}
+
+	// And removed with empty ones
+	serveTestRequest(handler, "PATCH", "/short/device0", `{"device_rules":{}}`, map[string]string{"X-Owner-Token": created.OwnerToken})
+	if rr = clickTestUrl(handler, "device0", client, map[string]string{"User-Agent": desktopUserAgent}); rr.Code != http.StatusPermanentRedirect || rr.Header().Get("Location") != "http://www.testsite1.com" {
+		t.Errorf("Error: Wrong redirect: got %v %q", rr.Code, rr.Header().Get("Location"))
+	}
+}
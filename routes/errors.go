@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/middleware"
+
+	"net/http"
+)
+
+// Writes an error response with the message encoded in json
+func jsonError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	middleware.JSONError(w, r, status, message)
+}
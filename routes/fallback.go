@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/helpers"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/policy"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"net"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Returns the fallback url of a short url: its own, the one of the domain it was requested on
+// or the default one. It is empty if none is configured.
+func fallbackUrl(r *http.Request, key string) string {
+	conf := config.Get().Fallback
+
+	fallback, err := redisStorage.GetFallback(r.Context(), key)
+	if err != nil {
+		// The usual response is still better than none
+		logger.FromContext(r.Context()).Error("Could not get fallback url", zap.Error(err))
+	}
+	if fallback != "" {
+		return fallback
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range conf.Domains {
+		if helpers.MatchDomain(host, domain.Domain) {
+			return domain.Url
+		}
+	}
+
+	return conf.DefaultUrl
+}
+
+// Redirects clients of a short url that is unknown, expired, disabled or exhausted to its fallback url.
+// It returns false if there is no fallback url, so the caller writes its usual response.
+func redirectToFallback(w http.ResponseWriter, r *http.Request, key string) bool {
+	fallback := fallbackUrl(r, key)
+	if fallback == "" {
+		return false
+	}
+
+	// Like destinations, fallback urls stop redirecting when the policy blocks them after they were set
+	if err := policy.Check(fallback); err != nil {
+		logger.FromContext(r.Context()).Warn("Fallback url blocked by the policy", zap.String("fallback", fallback), zap.Error(err))
+		return false
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, fallback, http.StatusFound)
+	return true
+}
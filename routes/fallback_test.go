@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFallbackUrl(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	client := randomTestIP() + ":41234"
+	defer deleteTestLink("fallback0")
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"fallback0","fallback_url":"javascript:alert(1)"}`, nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"fallback0","max_clicks":1,"fallback_url":"http://www.testsite2.com"}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = serveTestRequest(handler, "GET", "/info/fallback0", "", nil)
+	var info response
+	json.Unmarshal(rr.Body.Bytes(), &info)
+	if info.FallbackUrl != "http://www.testsite2.com" {
+		t.Errorf("Error: Wrong fallback url: got %q want %q", info.FallbackUrl, "http://www.testsite2.com")
+	}
+
+	// Exhausted short urls redirect to their fallback url
+	clickTestUrl(handler, "fallback0", client, nil)
+	rr = clickTestUrl(handler, "fallback0", client, nil)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "http://www.testsite2.com" {
+		t.Errorf("Error: Expected a redirect to the fallback url, got %v %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// And so do expired ones
+	deleteRedisKey("fallback0")
+	rr = clickTestUrl(handler, "fallback0", client, nil)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "http://www.testsite2.com" {
+		t.Errorf("Error: Expected a redirect to the fallback url, got %v %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// Fallback urls blocked after they were set are not redirected to
+	addRedisKeyValue("fallback:fallback0", "https://blocked.example.com")
+	rr = clickTestUrl(handler, "fallback0", client, nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	// Unknown short urls use the fallback url of the domain they are requested on
+	req, _ := http.NewRequest("GET", "http://go.example.com/fallback-unknown", nil)
+	req.RemoteAddr = client
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://www.example.com/campaigns" {
+		t.Errorf("Error: Expected a redirect to the domain fallback url, got %v %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	rr = clickTestUrl(handler, "fallback-unknown", client, nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
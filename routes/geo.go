@@ -0,0 +1,56 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/geoip"
+	"ilmavridis/url-shortener/helpers"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+
+	"go.uber.org/zap"
+)
+
+// ISO 3166-1 alpha-2 country codes, e.g. US
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// Checks the country codes and the urls of country rules.
+// On failure the error response is written and false is returned.
+func validateCountryRules(w http.ResponseWriter, r *http.Request, rules map[string]string, workspace redisStorage.Workspace) bool {
+	for _, country := range sortedRuleKeys(rules) {
+		if !countryCode.MatchString(country) {
+			jsonError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid country %q, use ISO 3166-1 alpha-2 codes like US", country))
+			return false
+		}
+		if !validateUrl(w, r, rules[country], workspace) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the destination of a short url for the country of the client, if one of its country rules matches.
+// Behind trusted proxies the country is the one of the address they forwarded the request for.
+func countryUrl(r *http.Request, link redisStorage.Link) (string, bool) {
+	if len(link.CountryRules) == 0 {
+		return "", false
+	}
+
+	ip := net.ParseIP(helpers.ClientIP(r))
+	if ip == nil {
+		return "", false
+	}
+	// Clients whose country can't be found get the default destination
+	country, err := geoip.Get().Country(ip)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Could not look up the country of the client", zap.Error(err))
+		return "", false
+	}
+
+	destination, ok := link.CountryRules[country]
+	return destination, ok
+}
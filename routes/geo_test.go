@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/geoip"
+	"ilmavridis/url-shortener/logger"
+
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// Locates the addresses of the tests without a GeoIP database
+type staticLocator map[string]string
+
+func (l staticLocator) Country(ip net.IP) (string, error) {
+	return l[ip.String()], nil
+}
+
+func TestCountryRules(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("country0")
+
+	greek, german, unknown := randomTestIP(), randomTestIP(), randomTestIP()
+	geoip.Set(staticLocator{greek: "GR", german: "DE"})
+	defer geoip.Init()
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"country0","country_rules":{"Greece":"http://www.testsite1.gr"}}`, nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"country0","country_rules":{"GR":"http://www.testsite1.gr","DE":"http://www.testsite1.de"}}`, nil)
+	var created response
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if rr.Code != http.StatusOK || len(created.CountryRules) != 2 {
+		t.Fatalf("Error: Short url with country rules not created: %v %s", rr.Code, rr.Body.String())
+	}
+
+	tests := []struct {
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{greek + ":41234", "", "http://www.testsite1.gr"},
+		{unknown + ":41234", "", "http://www.testsite1.com"},
+		// Behind a trusted proxy the client is the address it forwarded the request for
+		{"10.0.0.1:41234", german, "http://www.testsite1.de"},
+		{"10.0.0.1:41234", greek + ", 10.0.0.2", "http://www.testsite1.gr"},
+		// Other clients can't choose their country
+		{unknown + ":41234", greek, "http://www.testsite1.com"},
+	}
+	for _, test := range tests {
+		rr = clickTestUrl(handler, "country0", test.remoteAddr, map[string]string{"X-Forwarded-For": test.forwardedFor})
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != test.want {
+			t.Errorf("Error: Wrong redirect for %s (%s): got %v %q want %q", test.remoteAddr, test.forwardedFor, rr.Code, rr.Header().Get("Location"), test.want)
+		}
+	}
+
+	// Device rules come first
+	rr = serveTestRequest(handler, "PATCH", "/short/country0", `{"device_rules":{"ios":"https://apps.apple.com/app/id1"}}`, map[string]string{"X-Owner-Token": created.OwnerToken})
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	rr = clickTestUrl(handler, "country0", greek+":41234", map[string]string{"User-Agent": iPhoneUserAgent})
+	if rr.Header().Get("Location") != "https://apps.apple.com/app/id1" {
+		t.Errorf("Error: Wrong redirect: got %q want %q", rr.Header().Get("Location"), "https://apps.apple.com/app/id1")
+	}
+
+	rr = serveTestRequest(handler, "PATCH", "/short/country0", `{"country_rules":{"DE":"http://www.testsite1.de"}}`, map[string]string{"X-Owner-Token": created.OwnerToken})
+	var updated response
+	json.Unmarshal(rr.Body.Bytes(), &updated)
+	if len(updated.CountryRules) != 1 || len(updated.DeviceRules) != 1 {
+		t.Errorf("Error: Wrong rules after the update: got %s", rr.Body.String())
+	}
+	if rr = clickTestUrl(handler, "country0", greek+":41234", nil); rr.Header().Get("Location") != "http://www.testsite1.com" {
+		t.Errorf("Error: Wrong redirect: got %q want %q", rr.Header().Get("Location"), "http://www.testsite1.com")
+	}
+}
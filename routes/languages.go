@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/redisStorage"
+
+	"fmt"
+	"net/http"
+
+	"golang.org/x/text/language"
+)
+
+// Checks the language tags and the urls of language rules.
+// On failure the error response is written and false is returned.
+func validateLanguageRules(w http.ResponseWriter, r *http.Request, rules map[string]string, workspace redisStorage.Workspace) bool {
+	for _, tag := range sortedRuleKeys(rules) {
+		if _, err := language.Parse(tag); err != nil {
+			jsonError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid language %q, use BCP 47 tags like en or pt-BR", tag))
+			return false
+		}
+		if !validateUrl(w, r, rules[tag], workspace) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the destination of a short url for the Accept-Language header of the client, if one of its
+// language rules matches it. Languages that are only a distant match (e.g. zh-CN for zh-Hant) don't count.
+func languageUrl(r *http.Request, link redisStorage.Link) (string, bool) {
+	if len(link.LanguageRules) == 0 {
+		return "", false
+	}
+
+	accepted, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil || len(accepted) == 0 {
+		return "", false
+	}
+
+	// Sorted, so the same header always gets the same destination
+	rules := sortedRuleKeys(link.LanguageRules)
+	supported := make([]language.Tag, len(rules))
+	for i, rule := range rules {
+		supported[i] = language.Make(rule)
+	}
+
+	_, index, confidence := language.NewMatcher(supported).Match(accepted...)
+	if confidence < language.High {
+		return "", false
+	}
+	return link.LanguageRules[rules[index]], true
+}
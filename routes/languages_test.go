@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLanguageRules(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	client := randomTestIP() + ":41234"
+	defer deleteTestLink("language0")
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com/docs","short":"language0","language_rules":{"english!":"http://www.testsite1.com/en"}}`, nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com/docs","short":"language0","language_rules":{"de":"http://www.testsite1.com/de","pt-BR":"http://www.testsite1.com/pt","zh-Hant":"http://www.testsite1.com/zh"}}`, nil)
+	var created response
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if rr.Code != http.StatusOK || len(created.LanguageRules) != 3 {
+		t.Fatalf("Error: Short url with language rules not created: %v %s", rr.Code, rr.Body.String())
+	}
+
+	tests := map[string]string{
+		"de-AT,de;q=0.9":                     "http://www.testsite1.com/de",
+		"fr-CH, fr;q=0.9, de;q=0.8, *;q=0.5": "http://www.testsite1.com/de",
+		"pt-PT":                              "http://www.testsite1.com/pt",
+		"zh-TW":                              "http://www.testsite1.com/zh",
+		// Not close enough to any of the rules
+		"zh-CN": "http://www.testsite1.com/docs",
+		"fr":    "http://www.testsite1.com/docs",
+		"":      "http://www.testsite1.com/docs",
+		"x;;":   "http://www.testsite1.com/docs",
+	}
+	for acceptLanguage, want := range tests {
+		req, _ := http.NewRequest("GET", "/language0", nil)
+		req.RemoteAddr = client
+		req.Header.Set("Accept-Language", acceptLanguage)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != want {
+			t.Errorf("Error: Wrong redirect for %q: got %v %q want %q", acceptLanguage, rr.Code, rr.Header().Get("Location"), want)
+		}
+	}
+
+	rr = serveTestRequest(handler, "PATCH", "/short/language0", `{"language_rules":{"el":"http://www.testsite1.com/el"}}`, map[string]string{"X-Owner-Token": created.OwnerToken})
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	rr = serveTestRequest(handler, "GET", "/info/language0", "", nil)
+	var info response
+	json.Unmarshal(rr.Body.Bytes(), &info)
+	if len(info.LanguageRules) != 1 || info.LanguageRules["el"] != "http://www.testsite1.com/el" {
+		t.Errorf("Error: Wrong language rules: got %v", info.LanguageRules)
+	}
+}
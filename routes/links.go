@@ -0,0 +1,230 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/redisStorage"
+
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+// Fields of a short url that can be updated, missing fields are not changed
+type updateRequest struct {
+	Url         *string `json:"url"`
+	Password    *string `json:"password"`     // An empty password removes the protection
+	FallbackUrl *string `json:"fallback_url"` // An empty url removes the fallback
+
+	Passthrough  *redisStorage.Passthrough `json:"passthrough"`
+	DeviceRules  *map[string]string        `json:"device_rules"`  // Replaces the device rules, empty rules remove them
+	CountryRules *map[string]string        `json:"country_rules"` // Replaces the country rules, empty rules remove them
+
+	LanguageRules *map[string]string `json:"language_rules"` // Replaces the language rules, empty rules remove them
+
+	Variants *[]redisStorage.Variant `json:"variants"` // Replaces the variants, empty variants remove them
+
+	OpenGraph *redisStorage.OpenGraph `json:"open_graph"` // Replaces the Open Graph overrides, an empty object removes them
+}
+
+// Loads a short url that the client is allowed to manage, with the key it is stored under.
+// On failure the error response is written and false is returned.
+func manageableLink(w http.ResponseWriter, r *http.Request, shortUrl string) (string, string, redisStorage.Link, bool) {
+	redisClient := redisStorage.Get()
+
+	key, err := redisStorage.ResolveKey(r.Context(), shortUrl)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return "", "", redisStorage.Link{}, false
+	}
+
+	longUrl, err := redisClient.Get(r.Context(), key).Result()
+	if err == redis.Nil {
+		jsonError(w, r, http.StatusBadRequest, "short url not found")
+		return "", "", redisStorage.Link{}, false
+	} else if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return "", "", redisStorage.Link{}, false
+	}
+
+	link, err := redisStorage.GetLink(r.Context(), key)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return "", "", redisStorage.Link{}, false
+	}
+
+	// Links of other workspaces are reported as missing, so their short urls are not disclosed
+	if !canSee(r, link) {
+		jsonError(w, r, http.StatusBadRequest, "short url not found")
+		return "", "", redisStorage.Link{}, false
+	}
+
+	if !canManage(r, link) {
+		jsonError(w, r, http.StatusForbidden, "only the owner of the short url can manage it")
+		return "", "", redisStorage.Link{}, false
+	}
+
+	return key, longUrl, link, true
+}
+
+// Updates the url that a short url redirects to
+func UpdateUrl(w http.ResponseWriter, r *http.Request) {
+	redisClient := redisStorage.Get()
+
+	body := new(updateRequest)
+	if !decodeJSON(w, r, body) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	shortUrl := mux.Vars(r)["shortUrl"]
+	key, longUrl, link, ok := manageableLink(w, r, shortUrl)
+	if !ok {
+		return
+	}
+
+	workspace, err := loadWorkspace(r.Context(), link.Workspace)
+	if err != nil && err != errWorkspaceNotFound {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+	if body.Url != nil {
+		if !validateUrl(w, r, *body.Url, workspace) {
+			return
+		}
+		longUrl = *body.Url
+		// The new url passed the scanners, so a short url that they flagged works again
+		link.Disabled = false
+		link.Threat = ""
+	}
+	if body.FallbackUrl != nil && *body.FallbackUrl != "" && !validateUrl(w, r, *body.FallbackUrl, workspace) {
+		return
+	}
+
+	if body.Passthrough != nil {
+		if err := validatePassthrough(body.Passthrough); err != nil {
+			jsonError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		link.Passthrough = body.Passthrough
+	}
+
+	if body.DeviceRules != nil {
+		if !validateDeviceRules(w, r, *body.DeviceRules, workspace) {
+			return
+		}
+		link.DeviceRules = *body.DeviceRules
+	}
+
+	if body.CountryRules != nil {
+		if !validateCountryRules(w, r, *body.CountryRules, workspace) {
+			return
+		}
+		link.CountryRules = *body.CountryRules
+	}
+
+	if body.LanguageRules != nil {
+		if !validateLanguageRules(w, r, *body.LanguageRules, workspace) {
+			return
+		}
+		link.LanguageRules = *body.LanguageRules
+	}
+
+	if body.Variants != nil {
+		if !validateVariants(w, r, *body.Variants, workspace) {
+			return
+		}
+		link.Variants = *body.Variants
+	}
+
+	if body.OpenGraph != nil {
+		if !validateOpenGraph(w, r, body.OpenGraph) {
+			return
+		}
+		link.OpenGraph = body.OpenGraph
+		if *link.OpenGraph == (redisStorage.OpenGraph{}) {
+			link.OpenGraph = nil
+		}
+	}
+
+	if body.Password != nil {
+		link.PasswordHash = ""
+		if *body.Password != "" {
+			link.PasswordHash, err = hashPassword(*body.Password)
+			if err != nil {
+				jsonError(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+
+	// Updating a short url counts as using it, so its ttl is reset
+	expiry := linkExpiry(link)
+	err = redisClient.Set(r.Context(), key, longUrl, expiry).Err()
+	if err == nil && (body.Url != nil || body.Password != nil || body.Passthrough != nil || body.DeviceRules != nil || body.CountryRules != nil || body.LanguageRules != nil || body.Variants != nil || body.OpenGraph != nil) {
+		err = redisStorage.SaveLink(r.Context(), key, link, expiry)
+	}
+	if err == nil && body.Url != nil {
+		err = queuePreview(r, key, link)
+	}
+	if err == nil && body.FallbackUrl != nil {
+		err = redisStorage.SetFallback(r.Context(), key, *body.FallbackUrl, expiry)
+	}
+	if err == nil {
+		err = redisStorage.ExpireLink(r.Context(), key, link, expiry)
+	}
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	resp := response{
+		Url:         longUrl,
+		CustomShort: shortUrl,
+		ExpiresIn:   time.Duration(expiry.Seconds()),
+		Workspace:   link.Workspace,
+
+		PasswordProtected: link.PasswordHash != "",
+		Passthrough:       link.Passthrough,
+		DeviceRules:       link.DeviceRules,
+		CountryRules:      link.CountryRules,
+		LanguageRules:     link.LanguageRules,
+		Variants:          link.Variants,
+		OpenGraph:         link.OpenGraph,
+	}
+	resp.FallbackUrl, err = redisStorage.GetFallback(r.Context(), key)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "encoding response to json")
+		return
+	}
+
+	return
+}
+
+// Deletes a short url together with its analytics
+func DeleteUrl(w http.ResponseWriter, r *http.Request) {
+	shortUrl := mux.Vars(r)["shortUrl"]
+	key, _, link, ok := manageableLink(w, r, shortUrl)
+	if !ok {
+		return
+	}
+
+	err := redisStorage.DeleteLink(r.Context(), key)
+	if err == nil {
+		err = redisStorage.ReleaseLink(r.Context(), shortUrl, link)
+	}
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return
+}
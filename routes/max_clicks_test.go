@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Resolves a short url with the given headers from a client of its own, so the rate limits of other tests don't apply
+func clickTestUrl(handler http.Handler, shortUrl string, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/"+shortUrl, nil)
+	req.RemoteAddr = remoteAddr
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestMaxClicks(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	client := randomTestIP() + ":41234"
+	defer deleteTestLink("maxclicks0")
+	defer deleteTestLink("maxclicks1")
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"maxclicks0","max_clicks":-1}`, nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	// Single-use short url
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"maxclicks0","max_clicks":1}`, nil)
+	var created response
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if rr.Code != http.StatusOK || created.ClicksLeft == nil || *created.ClicksLeft != 1 {
+		t.Fatalf("Error: Single-use short url not created: %v %s", rr.Code, rr.Body.String())
+	}
+
+	rr = clickTestUrl(handler, "maxclicks0", client, nil)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusSeeOther)
+	}
+	rr = clickTestUrl(handler, "maxclicks0", client, nil)
+	if rr.Code != http.StatusGone {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusGone)
+	}
+
+	rr = serveTestRequest(handler, "GET", "/info/maxclicks0", "", nil)
+	var info response
+	json.Unmarshal(rr.Body.Bytes(), &info)
+	if info.MaxClicks != 1 || info.ClicksLeft == nil || *info.ClicksLeft != 0 {
+		t.Errorf("Error: Wrong clicks left: got %s", rr.Body.String())
+	}
+
+	// Concurrent clicks can't use more than max_clicks
+	serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"maxclicks1","max_clicks":5}`, nil)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	redirected := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := clickTestUrl(handler, "maxclicks1", client, nil)
+			if rr.Code == http.StatusSeeOther {
+				mu.Lock()
+				redirected++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if redirected != 5 {
+		t.Errorf("Error: Wrong number of redirects: got %v want %v", redirected, 5)
+	}
+}
@@ -0,0 +1,105 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Signs a JWT with the test key of testdata/jwks.json
+func signTestJWT(t *testing.T, claims jwt.MapClaims) string {
+	pemBytes, err := ioutil.ReadFile("testdata/jwt-private.pem")
+	if err != nil {
+		t.Errorf("Error at reading the test signing key: %v", err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+	if err != nil {
+		t.Errorf("Error at parsing the test signing key: %v", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Errorf("Error at signing the test token: %v", err)
+	}
+	return signed
+}
+
+func testUserClaims(subject string, email string, groups ...string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":    "https://sso.example.com",
+		"aud":    "url-shortener",
+		"sub":    subject,
+		"email":  email,
+		"groups": groups,
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestJWTOwnership(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("jwt0")
+
+	alice := map[string]string{"Authorization": "Bearer " + signTestJWT(t, testUserClaims("1", "alice@example.com"))}
+	bob := map[string]string{"Authorization": "Bearer " + signTestJWT(t, testUserClaims("2", "bob@example.com"))}
+	admin := map[string]string{"Authorization": "Bearer " + signTestJWT(t, testUserClaims("3", "admin@example.com", "shortener-admins"))}
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"jwt0"}`, alice)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// The creator is recorded
+	rr = serveTestRequest(handler, "GET", "/info/jwt0", "", alice)
+	var m map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &m)
+	if m["created_by"] != "alice@example.com" {
+		t.Errorf("Error: Wrong created_by: got %v want %v", m["created_by"], "alice@example.com")
+	}
+
+	// Other users can't manage the short url, admins can
+	rr = serveTestRequest(handler, "PATCH", "/short/jwt0", `{"url":"http://www.testsite2.com"}`, bob)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	rr = serveTestRequest(handler, "PATCH", "/short/jwt0", `{"url":"http://www.testsite2.com"}`, admin)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = serveTestRequest(handler, "DELETE", "/short/jwt0", "", alice)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+}
+
+func TestInvalidJWT(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+
+	expired := testUserClaims("1", "alice@example.com")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	otherAudience := testUserClaims("1", "alice@example.com")
+	otherAudience["aud"] = "another-service"
+
+	for _, claims := range []jwt.MapClaims{expired, otherAudience} {
+		headers := map[string]string{"Authorization": "Bearer " + signTestJWT(t, claims)}
+		rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com"}`, headers)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+		}
+	}
+}
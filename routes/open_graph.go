@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/policy"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/asaskevich/govalidator"
+)
+
+const (
+	maxOpenGraphTitle       = 200
+	maxOpenGraphDescription = 500
+)
+
+// User agents of the crawlers that unfurl links in chats and social networks, lowercase
+var crawlerUserAgents = []string{
+	"facebookexternalhit",
+	"facebot",
+	"twitterbot",
+	"slackbot",
+	"linkedinbot",
+	"discordbot",
+	"telegrambot",
+	"whatsapp",
+	"skypeuripreview",
+	"microsoftpreview",
+	"pinterest",
+	"redditbot",
+	"applebot",
+	"embedly",
+	"iframely",
+	"vkshare",
+	"mastodon",
+}
+
+// Returns whether a user agent is a link unfurler, which gets the Open Graph page instead of the redirect.
+// Anyone can send the user agent of a crawler, so the page is public and must not disclose the destination.
+func isCrawler(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, crawler := range crawlerUserAgents {
+		if strings.Contains(userAgent, crawler) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the Open Graph overrides of a short url.
+// On failure the error response is written and false is returned.
+func validateOpenGraph(w http.ResponseWriter, r *http.Request, og *redisStorage.OpenGraph) bool {
+	if og == nil {
+		return true
+	}
+
+	if utf8.RuneCountInString(og.Title) > maxOpenGraphTitle {
+		jsonError(w, r, http.StatusBadRequest, "open_graph title is too long")
+		return false
+	}
+	if utf8.RuneCountInString(og.Description) > maxOpenGraphDescription {
+		jsonError(w, r, http.StatusBadRequest, "open_graph description is too long")
+		return false
+	}
+
+	// The image is fetched by the crawlers, so it only has to pass the policy, not the checks of a destination
+	if og.Image != "" {
+		if err := policy.CheckScheme(og.Image); err != nil {
+			policyError(w, r, err)
+			return false
+		}
+		// Crawlers don't resolve relative urls or urls without a scheme
+		if !govalidator.IsURL(og.Image) || !strings.Contains(og.Image, "://") {
+			jsonError(w, r, http.StatusBadRequest, "invalid open_graph image url")
+			return false
+		}
+		if err := policy.Check(og.Image); err != nil {
+			policyError(w, r, err)
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const slackbotUserAgent = "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"
+
+func TestIsCrawler(t *testing.T) {
+	tests := map[string]bool{
+		slackbotUserAgent: true,
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)": true,
+		"Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)":         true,
+		"TelegramBot (like TwitterBot)":                                             true,
+		"WhatsApp/2.22.20.72 A":                                                     true,
+		iPhoneUserAgent:                                                             false,
+		desktopUserAgent:                                                            false,
+		"curl/7.81.0":                                                               false,
+	}
+	for userAgent, want := range tests {
+		if got := isCrawler(userAgent); got != want {
+			t.Errorf("Error: Wrong crawler detection of %q: got %v want %v", userAgent, got, want)
+		}
+	}
+}
+
+func TestOpenGraph(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	client := randomTestIP() + ":41234"
+	defer deleteTestLink("og0")
+
+	invalid := map[string]int{
+		`{"url":"http://www.testsite1.com","short":"og0","open_graph":{"image":"/images/card.png"}}`: http.StatusBadRequest,
+		// Images are checked by the url policy like destinations
+		`{"url":"http://www.testsite1.com","short":"og0","open_graph":{"image":"javascript:alert(1)"}}`:                              http.StatusForbidden,
+		`{"url":"http://www.testsite1.com","short":"og0","open_graph":{"title":"` + strings.Repeat("a", maxOpenGraphTitle+1) + `"}}`: http.StatusBadRequest,
+	}
+	for body, want := range invalid {
+		rr := serveTestRequest(handler, "POST", "/short", body, nil)
+		if rr.Code != want {
+			t.Errorf("Error: Handler returned wrong status code for %s: got %v want %v", body, rr.Code, want)
+		}
+	}
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"og0","max_clicks":1,"open_graph":{"title":"Spring <sale>","description":"Everything half price","image":"https://www.testsite1.com/card.png"}}`, nil)
+	var created response
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if rr.Code != http.StatusOK || created.OpenGraph == nil || created.OpenGraph.Title != "Spring <sale>" {
+		t.Fatalf("Error: Short url with open graph overrides not created: %v %s", rr.Code, rr.Body.String())
+	}
+
+	// Crawlers get the card and don't use up the clicks of the short url
+	for i := 0; i < 2; i++ {
+		rr = clickTestUrl(handler, "og0", client, map[string]string{"User-Agent": slackbotUserAgent})
+		body := rr.Body.String()
+		if rr.Code != http.StatusOK || !strings.Contains(body, `<META property="og:title" content="Spring &lt;sale&gt;">`) ||
+			!strings.Contains(body, `<META property="og:image" content="https://www.testsite1.com/card.png">`) {
+			t.Errorf("Error: Wrong open graph page: got %v %s", rr.Code, body)
+		}
+		if !strings.Contains(rr.Header().Get("Vary"), "User-Agent") {
+			t.Errorf("Error: Open graph page doesn't vary by user agent: got %q", rr.Header().Get("Vary"))
+		}
+	}
+
+	rr = serveTestRequest(handler, "GET", "/info/og0", "", nil)
+	var info response
+	json.Unmarshal(rr.Body.Bytes(), &info)
+	if info.ClicksLeft == nil || *info.ClicksLeft != 1 {
+		t.Errorf("Error: Crawlers used up clicks of the short url: got %v clicks left want 1", info.ClicksLeft)
+	}
+
+	rr = clickTestUrl(handler, "og0", client, map[string]string{"User-Agent": desktopUserAgent})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "http://www.testsite1.com" {
+		t.Errorf("Error: Wrong redirect: got %v %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// An empty object removes the overrides
+	rr = serveTestRequest(handler, "PATCH", "/short/og0", `{"open_graph":{}}`, map[string]string{"X-Owner-Token": created.OwnerToken})
+	var updated response
+	json.Unmarshal(rr.Body.Bytes(), &updated)
+	if rr.Code != http.StatusOK || updated.OpenGraph != nil {
+		t.Errorf("Error: Open graph overrides not removed: %v %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestOpenGraphProtected(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("og1")
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com/secret","short":"og1","password":"hunter22","open_graph":{"title":"Shared document"}}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// The card of a protected short url is shown without its destination
+	rr = serveTestRequest(handler, "GET", "/og1", "", map[string]string{"User-Agent": slackbotUserAgent})
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Shared document") || strings.Contains(rr.Body.String(), "secret") {
+		t.Errorf("Error: Wrong open graph page: got %v %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveTestRequest(handler, "GET", "/og1", "", map[string]string{"User-Agent": desktopUserAgent})
+	if rr.Code == http.StatusOK && strings.Contains(rr.Body.String(), "og:title") {
+		t.Errorf("Error: Open graph page served to a browser: %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/auth"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+)
+
+// Every short url gets a secret owner token when it is created.
+// Only its hash is stored, the token itself is returned once to the creator.
+func newOwnerToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Checks if the request carries the owner token of the link in the X-Owner-Token header
+func isOwner(r *http.Request, link redisStorage.Link) bool {
+	token := r.Header.Get("X-Owner-Token")
+	if token == "" || link.OwnerTokenHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth.HashToken(token)), []byte(link.OwnerTokenHash)) == 1
+}
+
+// Checks if the client can see the link. Links of a workspace are only visible to its members
+// and to the holder of their owner token, links outside workspaces to everyone.
+func canSee(r *http.Request, link redisStorage.Link) bool {
+	if link.Workspace == "" || isOwner(r, link) {
+		return true
+	}
+
+	principal := auth.FromContext(r.Context())
+	return principal != nil && principal.InWorkspace(link.Workspace)
+}
+
+// Checks if the client can manage the link: with its owner token, as the principal
+// that created it (if it has the manage scope), or as an admin of its workspace
+func canManage(r *http.Request, link redisStorage.Link) bool {
+	if isOwner(r, link) {
+		return true
+	}
+
+	principal := auth.FromContext(r.Context())
+	if principal == nil {
+		return false
+	}
+	if principal.AdminOf(link.Workspace) {
+		return true
+	}
+
+	return principal.HasScope(auth.ScopeManage) && link.Owner != "" && link.Owner == principal.ID
+}
@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/logger"
+
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var pages = template.Must(template.ParseFS(templateFiles, "templates/*.html"))
+
+// Renders an html page from the templates directory
+func renderPage(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) {
+	var buf bytes.Buffer
+	if err := pages.ExecuteTemplate(&buf, name, data); err != nil {
+		logger.FromContext(r.Context()).Error("Could not render page", zap.String("page", name), zap.Error(err))
+		jsonError(w, r, http.StatusInternalServerError, "rendering page")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/redisStorage"
+
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// How the query parameters that are in both the request and the destination are merged
+const (
+	mergeIncoming    = "incoming"    // The values of the request replace the ones of the destination
+	mergeDestination = "destination" // The values of the destination are kept
+	mergeAppend      = "append"      // The values of both are kept
+)
+
+func validatePassthrough(p *redisStorage.Passthrough) error {
+	if p == nil {
+		return nil
+	}
+	switch p.Merge {
+	case "", mergeIncoming, mergeDestination, mergeAppend:
+		return nil
+	}
+	return fmt.Errorf("unknown passthrough merge %q, use %s, %s or %s", p.Merge, mergeIncoming, mergeDestination, mergeAppend)
+}
+
+// Returns the destination of a short url with the path segments after the short url and the query
+// of the request appended, as its passthrough allows. Without anything to append it is the long url itself.
+func passthroughUrl(longUrl string, p *redisStorage.Passthrough, rest string, query url.Values) (string, error) {
+	if p == nil || (!p.Path || rest == "") && (!p.Query || len(query) == 0) {
+		return longUrl, nil
+	}
+
+	u, err := url.Parse(longUrl)
+	if err != nil {
+		return "", err
+	}
+
+	if p.Path && rest != "" {
+		// Cleaned, so the segments can't climb above the path of the destination
+		joined := path.Join("/", rest)
+		if strings.HasSuffix(rest, "/") {
+			joined += "/"
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/") + joined
+		u.RawPath = ""
+	}
+
+	if p.Query && len(query) > 0 {
+		// Appended, so the order and encoding of the parameters of the destination don't change
+		existing := u.Query()
+		added := url.Values{}
+		for key, incoming := range query {
+			if p.Merge == mergeDestination && len(existing[key]) > 0 {
+				continue
+			}
+			added[key] = incoming
+		}
+		if p.Merge != mergeAppend && p.Merge != mergeDestination {
+			u.RawQuery = removeParams(u.RawQuery, added)
+		}
+		u.RawQuery = appendQuery(u.RawQuery, added)
+	}
+
+	return u.String(), nil
+}
+
+// Removes the parameters from a raw query, without changing the order and encoding of the others
+func removeParams(rawQuery string, params url.Values) string {
+	var kept []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key := pair
+		if i := strings.Index(key, "="); i >= 0 {
+			key = key[:i]
+		}
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if _, ok := params[key]; !ok {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// Appends parameters to a raw query, without changing the order and encoding of the ones it has
+func appendQuery(rawQuery string, params url.Values) string {
+	if len(params) == 0 {
+		return rawQuery
+	}
+	query := strings.TrimSuffix(rawQuery, "&")
+	if query != "" {
+		query += "&"
+	}
+	return query + params.Encode()
+}
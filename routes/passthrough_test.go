@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestPassthroughUrl(t *testing.T) {
+	query := url.Values{"utm_source": {"x"}, "id": {"2"}}
+
+	tests := []struct {
+		passthrough *redisStorage.Passthrough
+		rest        string
+		want        string
+	}{
+		{nil, "extra", "https://www.testsite1.com/docs?id=1"},
+		{&redisStorage.Passthrough{Query: true}, "", "https://www.testsite1.com/docs?id=2&utm_source=x"},
+		{&redisStorage.Passthrough{Query: true, Merge: mergeDestination}, "", "https://www.testsite1.com/docs?id=1&utm_source=x"},
+		{&redisStorage.Passthrough{Query: true, Merge: mergeAppend}, "", "https://www.testsite1.com/docs?id=1&id=2&utm_source=x"},
+		{&redisStorage.Passthrough{Path: true}, "guides/start/", "https://www.testsite1.com/docs/guides/start/?id=1"},
+		{&redisStorage.Passthrough{Path: true}, "../../admin", "https://www.testsite1.com/docs/admin?id=1"},
+	}
+	for _, test := range tests {
+		got, err := passthroughUrl("https://www.testsite1.com/docs?id=1", test.passthrough, test.rest, query)
+		if err != nil || got != test.want {
+			t.Errorf("Error: Wrong destination: got %q want %q (%v)", got, test.want, err)
+		}
+	}
+
+	// The parameters of the destination keep their order and encoding
+	got, _ := passthroughUrl("https://www.testsite1.com/docs?z=1&list=a%2Cb&id=1", &redisStorage.Passthrough{Query: true}, "", query)
+	if want := "https://www.testsite1.com/docs?z=1&list=a%2Cb&id=2&utm_source=x"; got != want {
+		t.Errorf("Error: Wrong destination: got %q want %q", got, want)
+	}
+
+	if err := validatePassthrough(&redisStorage.Passthrough{Query: true, Merge: "first"}); err == nil {
+		t.Errorf("Error: Unknown merge rule accepted")
+	}
+}
+
+func TestPassthrough(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	client := randomTestIP() + ":41234"
+	defer deleteTestLink("passthrough0")
+	defer deleteTestLink("passthrough1")
+	defer deleteTestLink("passthrough2")
+
+	serveTestRequest(handler, "POST", "/short", `{"url":"https://www.testsite1.com/docs","short":"passthrough0","passthrough":{"query":true,"path":true}}`, nil)
+	serveTestRequest(handler, "POST", "/short", `{"url":"https://www.testsite1.com/docs","short":"passthrough1"}`, nil)
+
+	rr := clickTestUrl(handler, "passthrough0/guides?utm_source=x", client, nil)
+	if rr.Code != http.StatusPermanentRedirect || rr.Header().Get("Location") != "https://www.testsite1.com/docs/guides?utm_source=x" {
+		t.Errorf("Error: Wrong redirect: got %v %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// Appended paths are checked against the policy too
+	serveTestRequest(handler, "POST", "/short", `{"url":"https://www.testsite1.com","short":"passthrough2","passthrough":{"path":true}}`, nil)
+	rr = clickTestUrl(handler, "passthrough2/phishing/login", client, nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	// The paths after the short urls of these names are routes of the service
+	for _, reserved := range []string{"info", "short", "admin", "images"} {
+		rr = serveTestRequest(handler, "POST", "/short", `{"url":"https://www.testsite1.com","short":"`+reserved+`","passthrough":{"path":true}}`, nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Error: Handler returned wrong status code for %s: got %v want %v", reserved, rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	// Without passthrough the query is not appended and paths are not found
+	rr = clickTestUrl(handler, "passthrough1?utm_source=x", client, nil)
+	if rr.Header().Get("Location") != "https://www.testsite1.com/docs" {
+		t.Errorf("Error: Wrong redirect: got %q", rr.Header().Get("Location"))
+	}
+	rr = clickTestUrl(handler, "passthrough1/guides", client, nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
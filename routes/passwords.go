@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt ignores the bytes after the first 72
+const maxPasswordLength = 72
+
+const passwordRequired = "password required"
+
+// Brute-force protection when none is configured
+const (
+	defaultMaxAttempts = 5
+	defaultLockout     = 15 * time.Minute
+)
+
+// Hashes the password of a short url with the configured bcrypt cost
+func hashPassword(password string) (string, error) {
+	if len(password) > maxPasswordLength {
+		return "", fmt.Errorf("the password can't be longer than %d bytes", maxPasswordLength)
+	}
+
+	cost := config.Get().Passwords.Cost
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	return string(hash), err
+}
+
+// Browsers get html pages instead of json errors
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// Checks the password of a protected short url, sent by api clients in the X-Link-Password header
+// and by browsers in the password parameter of a posted form. It is not read from the query string,
+// which ends up in logs and histories. Short urls are locked for a while after too many
+// wrong passwords. On failure the password prompt or an error response is written and false is returned.
+func checkLinkPassword(w http.ResponseWriter, r *http.Request, key string, link redisStorage.Link) bool {
+	conf := config.Get().Passwords
+	if conf.MaxAttempts <= 0 {
+		conf.MaxAttempts = defaultMaxAttempts
+	}
+	if conf.Lockout <= 0 {
+		conf.Lockout = defaultLockout
+	}
+
+	password := r.Header.Get("X-Link-Password")
+	if password == "" {
+		password = r.PostFormValue("password")
+	}
+	if password == "" {
+		passwordError(w, r, key, http.StatusUnauthorized, passwordRequired, 0)
+		return false
+	}
+
+	lockout, err := redisStorage.PasswordLockout(r.Context(), key, conf.MaxAttempts)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return false
+	}
+	if lockout > 0 {
+		passwordError(w, r, key, http.StatusTooManyRequests, "too many wrong passwords, try again later", lockout)
+		return false
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		failures, err := redisStorage.PasswordFailed(r.Context(), key, conf.MaxAttempts, conf.Lockout)
+		if err != nil {
+			jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+			return false
+		}
+		if failures >= conf.MaxAttempts {
+			passwordError(w, r, key, http.StatusTooManyRequests, "too many wrong passwords, try again later", conf.Lockout)
+			return false
+		}
+		passwordError(w, r, key, http.StatusUnauthorized, "wrong password", 0)
+		return false
+	} else if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "checking password")
+		return false
+	}
+
+	if err := redisStorage.ResetPasswordFailures(r.Context(), key); err != nil {
+		logger.FromContext(r.Context()).Error("Could not reset wrong passwords", zap.Error(err))
+	}
+
+	return true
+}
+
+// Writes the password prompt for browsers and a json error for api clients
+func passwordError(w http.ResponseWriter, r *http.Request, key string, status int, message string, retryAfter time.Duration) {
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int64(math.Ceil(retryAfter.Seconds()))))
+	}
+
+	if !wantsHTML(r) {
+		jsonError(w, r, status, message)
+		return
+	}
+
+	// The password is posted back to the path and query of the request, so they are still passed through
+	data := map[string]string{"Short": redisStorage.ShortUrlOf(key), "Action": r.URL.RequestURI()}
+	// The prompt is shown without an error the first time
+	if message != passwordRequired {
+		data["Error"] = message
+	}
+	renderPage(w, r, status, "password.html", data)
+}
@@ -0,0 +1,165 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPasswordProtectedUrl(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("password0")
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com/doc","short":"password0","password":"s3cret"}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var created response
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if !created.PasswordProtected {
+		t.Errorf("Error: Short url is not password protected")
+	}
+
+	// Browsers get the password prompt
+	rr = serveTestRequest(handler, "GET", "/password0", "", map[string]string{"Accept": "text/html"})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if !strings.Contains(rr.Body.String(), `name="password"`) {
+		t.Errorf("Error: Expected the password prompt, got %q", rr.Body.String())
+	}
+
+	rr = serveTestRequest(handler, "GET", "/password0", "", nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// The destination is not disclosed by info
+	rr = serveTestRequest(handler, "GET", "/info/password0", "", nil)
+	var info response
+	json.Unmarshal(rr.Body.Bytes(), &info)
+	if info.Url != "" || !info.PasswordProtected {
+		t.Errorf("Error: Info of a protected short url: got %+v", info)
+	}
+	rr = serveTestRequest(handler, "GET", "/info/password0", "", map[string]string{"X-Owner-Token": created.OwnerToken})
+	json.Unmarshal(rr.Body.Bytes(), &info)
+	if info.Url != "http://www.testsite1.com/doc" {
+		t.Errorf("Error: Wrong url for the owner: got %q", info.Url)
+	}
+
+	// The form of the prompt and the header of api clients
+	rr = serveTestRequest(handler, "POST", "/password0", "password=s3cret", map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "http://www.testsite1.com/doc" {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusSeeOther)
+	}
+	rr = serveTestRequest(handler, "GET", "/password0", "", map[string]string{"X-Link-Password": "s3cret"})
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusSeeOther)
+	}
+
+	// Passwords in the query string are not accepted
+	rr = serveTestRequest(handler, "GET", "/password0?password=s3cret", "", nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// The short url is locked after too many wrong passwords, even for the right one
+	for i := 1; i <= 3; i++ {
+		want := http.StatusUnauthorized
+		if i == 3 {
+			want = http.StatusTooManyRequests
+		}
+		rr = serveTestRequest(handler, "GET", "/password0", "", map[string]string{"X-Link-Password": "guess"})
+		if rr.Code != want {
+			t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, want)
+		}
+	}
+	rr = serveTestRequest(handler, "GET", "/password0", "", map[string]string{"X-Link-Password": "s3cret"})
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+
+	// The protection is removed with an empty password
+	rr = serveTestRequest(handler, "PATCH", "/short/password0", `{"password":""}`, map[string]string{"X-Owner-Token": created.OwnerToken})
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	rr = serveTestRequest(handler, "GET", "/password0", "", nil)
+	if rr.Code != http.StatusPermanentRedirect {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusPermanentRedirect)
+	}
+
+	// Without the prompt nothing posts to the short url, the redirect would repeat the post at the destination
+	rr = serveTestRequest(handler, "POST", "/password0", "password=s3cret", map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+// The prompt keeps the path and query that a protected short url passes through
+func TestPasswordProtectedPassthrough(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("password2")
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com/docs","short":"password2","password":"s3cret","passthrough":{"path":true,"query":true}}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = serveTestRequest(handler, "GET", "/password2/guides?lang=en", "", map[string]string{"Accept": "text/html"})
+	if rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), `action="/password2/guides?lang=en"`) {
+		t.Errorf("Error: Wrong password prompt: got %v %q", rr.Code, rr.Body.String())
+	}
+
+	rr = serveTestRequest(handler, "POST", "/password2/guides?lang=en", "password=s3cret", map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "http://www.testsite1.com/docs/guides?lang=en" {
+		t.Errorf("Error: Wrong redirect: got %v %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// A password parameter of the query is the destination's, not the one of the short url
+	rr = serveTestRequest(handler, "GET", "/password2/reset?password=new", "", map[string]string{"X-Link-Password": "s3cret"})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "http://www.testsite1.com/docs/reset?password=new" {
+		t.Errorf("Error: Wrong redirect: got %v %q", rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+func TestPasswordProtectedInfo(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("password1")
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com/url","short":"password1","password":"s3cret",
+		"fallback_url":"http://www.testsite1.com/fallback","passthrough":{"query":true},
+		"device_rules":{"ios":"http://www.testsite1.com/device"},"country_rules":{"DE":"http://www.testsite1.com/country"},
+		"language_rules":{"de":"http://www.testsite1.com/language"},
+		"variants":[{"url":"http://www.testsite1.com/variant-a","weight":1},{"url":"http://www.testsite1.com/variant-b","weight":1}],
+		"open_graph":{"title":"Card","image":"http://www.testsite1.com/card.png"}}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Error: Handler returned wrong status code: got %v want %v %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var created response
+	json.Unmarshal(rr.Body.Bytes(), &created)
+
+	// None of the destinations are disclosed to anonymous clients
+	rr = serveTestRequest(handler, "GET", "/info/password1", "", nil)
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "testsite1") || strings.Contains(rr.Body.String(), "passthrough") ||
+		strings.Contains(rr.Body.String(), "open_graph") || !strings.Contains(rr.Body.String(), `"password_protected":true`) {
+		t.Errorf("Error: Info of a protected short url: got %v %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveTestRequest(handler, "GET", "/info/password1", "", map[string]string{"X-Owner-Token": created.OwnerToken})
+	for _, destination := range []string{"/url", "/fallback", "/device", "/country", "/language", "/variant-a", "/card.png"} {
+		if !strings.Contains(rr.Body.String(), "http://www.testsite1.com"+destination) {
+			t.Errorf("Error: Info for the owner is missing %s: got %s", destination, rr.Body.String())
+		}
+	}
+}
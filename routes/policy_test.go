@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Returns the rule of a policy error response
+func policyRule(body string) string {
+	var m struct {
+		Policy struct {
+			Rule string
+		}
+	}
+	json.Unmarshal([]byte(strings.Split(body, "\n")[1]), &m)
+	return m.Policy.Rule
+}
+
+func TestPolicy(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("policy0")
+
+	// Rules of the configuration and of its rules file
+	tests := []struct {
+		url  string
+		rule string
+	}{
+		{"https://login.blocked.example.com", "domain:blocked.example.com"},
+		{"https://file-blocked.example.com", "domain:file-blocked.example.com"},
+		{"http://www.testsite1.com/phishing", "regex:^https?://[^/]+/phishing"},
+	}
+	for _, test := range tests {
+		rr := serveTestRequest(handler, "POST", "/short", `{"url":"`+test.url+`"}`, nil)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+		}
+		if rule := policyRule(rr.Body.String()); rule != test.rule {
+			t.Errorf("Error: Wrong policy rule: got %q want %q", rule, test.rule)
+		}
+	}
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"https://safe.blocked.example.com","short":"policy0"}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var created response
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	owner := map[string]string{"X-Owner-Token": created.OwnerToken}
+
+	// Updates are checked too
+	rr = serveTestRequest(handler, "PATCH", "/short/policy0", `{"url":"http://192.168.1.1/"}`, owner)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	// Destinations blocked after the short url was created stop redirecting
+	addRedisKeyValue("policy0", "https://blocked.example.com")
+	rr = serveTestRequest(handler, "GET", "/policy0", "", nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,128 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+type previewPage struct {
+	Short     string
+	NotFound  bool
+	Protected bool   // The destination is not disclosed
+	Pending   string // The short url is not active until then, its destination is not disclosed
+	Url       string
+	Title     string
+	Favicon   template.URL
+	Fetching  bool // The title and favicon are not fetched yet
+	Targeted  bool // Some clients get other destinations
+	CreatedAt string
+	Threat    string
+	Scanned   bool // New short urls are checked by a url scanner
+}
+
+// Renders the preview page of a short url, so users can see where it goes before following it.
+// The title and favicon of the destination are fetched by a background job and shown once they are ready.
+func PreviewUrl(w http.ResponseWriter, r *http.Request) {
+	redisClient := redisStorage.Get()
+
+	shortUrl := mux.Vars(r)["shortUrl"]
+	page := previewPage{Short: shortUrl}
+
+	key, err := redisStorage.ResolveKey(r.Context(), shortUrl)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+	longUrl, err := redisClient.Get(r.Context(), key).Result()
+	if err == redis.Nil {
+		page.NotFound = true
+		renderPage(w, r, http.StatusNotFound, "preview.html", page)
+		return
+	} else if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	link, err := redisStorage.GetLink(r.Context(), key)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	page.Threat = link.Threat
+	page.Scanned = len(config.Get().Scanner.Checkers) > 0
+	if !link.CreatedAt.IsZero() {
+		page.CreatedAt = link.CreatedAt.Format("January 2, 2006")
+	}
+
+	// Like resolving, previews follow the activation window: the destination is not disclosed before it
+	// and the short url is gone after it
+	now := time.Now()
+	if link.ActiveFrom != nil && now.Before(*link.ActiveFrom) {
+		page.Pending = link.ActiveFrom.UTC().Format(time.RFC1123)
+		w.Header().Set("Cache-Control", "no-store")
+		renderPage(w, r, http.StatusOK, "preview.html", page)
+		return
+	}
+	if link.ActiveUntil != nil && !now.Before(*link.ActiveUntil) {
+		page.NotFound = true
+		renderPage(w, r, http.StatusNotFound, "preview.html", page)
+		return
+	}
+
+	// Like info, the destination of a protected short url is not disclosed, not even by its title
+	if link.PasswordHash != "" {
+		page.Protected = true
+		renderPage(w, r, http.StatusOK, "preview.html", page)
+		return
+	}
+
+	page.Url = longUrl
+	page.Targeted = len(link.DeviceRules) > 0 || len(link.CountryRules) > 0 || len(link.LanguageRules) > 0 || len(link.Variants) > 0
+
+	preview, ok, err := redisStorage.GetPreview(r.Context(), key)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+	// Previews of an older url of the short url are not shown
+	if ok && preview.Url == longUrl {
+		page.Title = preview.Title
+		if strings.HasPrefix(preview.Favicon, "data:image/") {
+			page.Favicon = template.URL(preview.Favicon)
+		}
+	} else {
+		page.Fetching = config.Get().Preview.Interval > 0 && !link.Disabled
+	}
+
+	// Queues the short urls without a preview or with an old one, the page shows what is there until then
+	maxAge := config.Get().Preview.MaxAge
+	if !ok || preview.Url != longUrl || (maxAge > 0 && time.Since(preview.FetchedAt) > maxAge) {
+		if err := queuePreview(r, key, link); err != nil {
+			jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	renderPage(w, r, http.StatusOK, "preview.html", page)
+
+	return
+}
+
+// Queues a short url for the background job, unless the job is disabled and nothing would take it from the queue.
+// The destinations of disabled short urls are not fetched.
+func queuePreview(r *http.Request, key string, link redisStorage.Link) error {
+	if config.Get().Preview.Interval <= 0 || link.Disabled {
+		return nil
+	}
+	return redisStorage.QueuePreview(r.Context(), key)
+}
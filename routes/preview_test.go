@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/preview"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreviewPage(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("preview0")
+	defer deleteTestLink("preview1")
+
+	rr := serveTestRequest(handler, "GET", "/preview/preview0", "", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com/article","short":"preview0"}`, nil)
+	for _, path := range []string{"/preview0+", "/preview/preview0"} {
+		rr = serveTestRequest(handler, "GET", path, "", nil)
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "http://www.testsite1.com/article") || !strings.Contains(rr.Body.String(), `action="/preview0"`) {
+			t.Errorf("Error: Wrong preview page at %s: got %v %q", path, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Shows the title and favicon once the background job fetched them
+	client, err := redisStorage.NewClient()
+	if err != nil {
+		t.Fatalf("Error at connecting to redis: %v", err)
+	}
+	defer client.Close()
+	redisStorage.SavePreview(context.Background(), client, "preview0", redisStorage.Preview{
+		Url:       "http://www.testsite1.com/article",
+		Title:     "Test <Article>",
+		Favicon:   "data:image/png;base64,iVBORw0KGgo=",
+		FetchedAt: time.Now(),
+	})
+	rr = serveTestRequest(handler, "GET", "/preview0+", "", nil)
+	if !strings.Contains(rr.Body.String(), "Test &lt;Article&gt;") || !strings.Contains(rr.Body.String(), `SRC="data:image/png;base64,iVBORw0KGgo="`) {
+		t.Errorf("Error: Expected the title and favicon, got %q", rr.Body.String())
+	}
+
+	// Protected short urls don't disclose their destination
+	serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com/secret","short":"preview1","password":"s3cret"}`, nil)
+	rr = serveTestRequest(handler, "GET", "/preview1+", "", nil)
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "/secret") || !strings.Contains(rr.Body.String(), "password") {
+		t.Errorf("Error: Wrong preview page of a protected short url: got %v %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestPreviewInternalDestination(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("preview2")
+
+	// Only the short url of this test is in the queue, so no other destination is fetched
+	deleteRedisKey("preview-queue")
+	addRedisKeyValue("preview2", "http://localhost:8080/admin")
+	rr := serveTestRequest(handler, "GET", "/preview2+", "", nil)
+	if !strings.Contains(rr.Body.String(), "Loading the title") {
+		t.Errorf("Error: Expected the title to be loading, got %q", rr.Body.String())
+	}
+
+	client, err := redisStorage.NewClient()
+	if err != nil {
+		t.Fatalf("Error at connecting to redis: %v", err)
+	}
+	defer client.Close()
+	fetched, err := preview.ProcessQueue(context.Background(), client)
+	if err != nil || fetched != 1 {
+		t.Fatalf("Error: Wrong number of fetched previews: got %v (%v) want 1", fetched, err)
+	}
+
+	stored, ok, _ := redisStorage.GetPreview(context.Background(), "preview2")
+	if !ok || !strings.Contains(stored.Error, "internal:loopback") || stored.Title != "" {
+		t.Errorf("Error: Internal destination fetched: got %+v", stored)
+	}
+
+	rr = serveTestRequest(handler, "GET", "/preview2+", "", nil)
+	if !strings.Contains(rr.Body.String(), "No title") {
+		t.Errorf("Error: Expected no title, got %q", rr.Body.String())
+	}
+}
+
+func TestPreviewDisabled(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("preview3")
+
+	deleteRedisKey("preview-queue")
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com/flagged","short":"preview3"}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	client, err := redisStorage.NewClient()
+	if err != nil {
+		t.Fatalf("Error at connecting to redis: %v", err)
+	}
+	defer client.Close()
+	if err := redisStorage.DisableLink(context.Background(), client, "preview3", "MALWARE"); err != nil {
+		t.Fatalf("Error at disabling the short url: %v", err)
+	}
+
+	// Queued before it was disabled, its destination is not fetched
+	fetched, err := preview.ProcessQueue(context.Background(), client)
+	if err != nil || fetched != 0 {
+		t.Errorf("Error: Wrong number of fetched previews: got %v (%v) want 0", fetched, err)
+	}
+	if _, ok, _ := redisStorage.GetPreview(context.Background(), "preview3"); ok {
+		t.Errorf("Error: Preview of a disabled short url fetched")
+	}
+
+	// And it is not queued again by its preview page
+	rr = serveTestRequest(handler, "GET", "/preview3+", "", nil)
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "Loading the title") {
+		t.Errorf("Error: Wrong preview page of a disabled short url: got %v %q", rr.Code, rr.Body.String())
+	}
+	if queued, _ := client.SIsMember(context.Background(), "preview-queue", "preview3").Result(); queued {
+		t.Errorf("Error: Disabled short url queued for its preview")
+	}
+}
+
+func TestPreviewPending(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("preview4")
+
+	activeFrom := time.Now().Add(time.Hour).UTC()
+	body := fmt.Sprintf(`{"url":"http://www.testsite1.com/launch","short":"preview4","active_from":"%s"}`, activeFrom.Format(time.RFC3339))
+	if rr := serveTestRequest(handler, "POST", "/short", body, nil); rr.Code != http.StatusOK {
+		t.Fatalf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Like resolving it, the preview doesn't disclose the destination before the short url is active
+	rr := serveTestRequest(handler, "GET", "/preview4+", "", nil)
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "/launch") || !strings.Contains(rr.Body.String(), activeFrom.Format(time.RFC1123)) {
+		t.Errorf("Error: Wrong preview page of a pending short url: got %v %q", rr.Code, rr.Body.String())
+	}
+}
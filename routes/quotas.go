@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/auth"
+	"ilmavridis/url-shortener/middleware"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"encoding/json"
+	"net/http"
+)
+
+type quotaResponse struct {
+	Quotas []redisStorage.QuotaUsage `json:"quotas"`
+}
+
+// Returns the quotas that count the short urls created by the request:
+// the quota of the authenticated client and the quota of its workspace
+func requestQuotas(r *http.Request, workspace redisStorage.Workspace) []redisStorage.Quota {
+	var quotas []redisStorage.Quota
+
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		quotas = append(quotas, redisStorage.PrincipalQuota(principal.ID, principal.MaxLinks, principal.MaxLinksPerDay))
+	}
+	if workspace.ID != "" {
+		quotas = append(quotas, redisStorage.WorkspaceQuota(workspace))
+	}
+
+	return quotas
+}
+
+// Writes the error response of an exceeded quota, describing the quota so clients can handle it
+func quotaError(w http.ResponseWriter, r *http.Request, exceeded *redisStorage.QuotaExceeded) {
+	middleware.JSONErrorWith(w, r, http.StatusForbidden, "quota exceeded", map[string]interface{}{
+		"quota": map[string]interface{}{
+			"owner": exceeded.Quota.Owner,
+			"limit": exceeded.Limit,
+			"max":   exceeded.Max,
+		},
+	})
+}
+
+// Returns the usage of the quotas of the authenticated client and its workspace
+func QuotaUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	// Anonymous clients have no quotas
+	if auth.FromContext(r.Context()) == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="url-shortener"`)
+		jsonError(w, r, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	workspace, ok := requestWorkspace(w, r)
+	if !ok {
+		return
+	}
+
+	usage, err := redisStorage.GetQuotaUsage(r.Context(), requestQuotas(r, workspace))
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(quotaResponse{usage}); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "encoding response to json")
+		return
+	}
+
+	return
+}
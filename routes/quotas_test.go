@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestQuotaExceeded(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("quota0")
+	defer deleteTestLink("quota1")
+
+	key, id := issueTestAPIKey(t, handler, `{"name":"quota","scopes":["create","manage"],"max_links":1,"max_links_per_day":2}`)
+	headers := map[string]string{"X-API-Key": key}
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"quota0"}`, headers)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// The api key has one active short url
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"quota1"}`, headers)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	var m struct {
+		Error string
+		Quota struct {
+			Owner string
+			Limit string
+			Max   int64
+		}
+	}
+	json.Unmarshal([]byte(strings.Split(rr.Body.String(), "\n")[1]), &m)
+	if m.Error != "quota exceeded" || m.Quota.Owner != "apikey:"+id || m.Quota.Limit != "max_links" || m.Quota.Max != 1 {
+		t.Errorf("Error: Wrong quota error: got %+v", m)
+	}
+	// and the name of the rejected short url is not claimed
+	if n, _ := redisStorage.Get().Exists(redisStorage.Ctx, "short:quota1").Result(); n != 0 {
+		t.Errorf("Error: Short url rejected by the quota is still claimed")
+	}
+
+	// Deleting it frees the quota of active short urls, but not the daily one
+	serveTestRequest(handler, "DELETE", "/short/quota0", "", headers)
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"quota1"}`, headers)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	serveTestRequest(handler, "DELETE", "/short/quota1", "", headers)
+
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"quota0"}`, headers)
+	json.Unmarshal([]byte(strings.Split(rr.Body.String(), "\n")[1]), &m)
+	if rr.Code != http.StatusForbidden || m.Quota.Limit != "max_links_per_day" {
+		t.Errorf("Error: Daily quota not enforced: got %v %+v", rr.Code, m)
+	}
+}
+
+func TestQuotaReleasedOnError(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("quota3")
+
+	key, _ := issueTestAPIKey(t, handler, `{"name":"quota","scopes":["create"],"max_links":1}`)
+	headers := map[string]string{"X-API-Key": key}
+
+	// A preview queue of the wrong type fails the creation after the quota was reserved
+	addRedisKeyValue("preview-queue", "broken")
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"quota3"}`, headers)
+	deleteRedisKey("preview-queue")
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+
+	// The failed short url neither counts in the quota nor takes its name
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"quota3"}`, headers)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestQuotaUsage(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("quota2")
+
+	ws := createTestWorkspace(t, handler, `,"max_links":10`)
+	key, id := issueTestAPIKey(t, handler, fmt.Sprintf(`{"name":"quota","scopes":["create"],"workspace":"%s","max_links_per_day":5}`, ws))
+	headers := map[string]string{"X-API-Key": key}
+
+	serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"quota2"}`, headers)
+
+	rr := serveTestRequest(handler, "GET", "/quota", "", headers)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var resp quotaResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if len(resp.Quotas) != 2 {
+		t.Fatalf("Error: Wrong number of quotas: got %v want %v", len(resp.Quotas), 2)
+	}
+
+	expected := []struct {
+		owner          string
+		maxLinks       int64
+		maxLinksPerDay int64
+	}{
+		{"apikey:" + id, 0, 5},
+		{"workspace:" + ws, 10, 0},
+	}
+	for i, quota := range resp.Quotas {
+		if quota.Owner != expected[i].owner || quota.MaxLinks != expected[i].maxLinks || quota.MaxLinksPerDay != expected[i].maxLinksPerDay {
+			t.Errorf("Error: Wrong quota: got %+v want %+v", quota.Quota, expected[i])
+		}
+		if quota.ActiveLinks != 1 || quota.LinksToday != 1 {
+			t.Errorf("Error: Wrong usage of %s: got %v active and %v today want 1 and 1", quota.Owner, quota.ActiveLinks, quota.LinksToday)
+		}
+	}
+
+	// Anonymous clients have no quotas
+	rr = serveTestRequest(handler, "GET", "/quota", "", nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
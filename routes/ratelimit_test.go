@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Resolves a missing short url from the given address, optionally through a proxy
+func resolveFrom(handler http.Handler, remoteAddr string, forwardedFor string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/ratelimit0", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+var testRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// Returns a random address of the benchmarking range 198.18.0.0/15, so every run gets fresh buckets
+func randomTestIP() string {
+	return fmt.Sprintf("198.%d.%d.%d", 18+testRand.Intn(2), testRand.Intn(256), testRand.Intn(256))
+}
+
+func TestRateLimit(t *testing.T) {
+	logger.New()
+	config.Read()
+	conf := config.Get()
+	handler := New().Handler
+
+	client := randomTestIP() + ":41234"
+	burst := int(conf.RateLimit.Resolve.Burst)
+
+	for i := 0; i < burst; i++ {
+		rr := resolveFrom(handler, client, "")
+		if rr.Code == http.StatusTooManyRequests {
+			t.Fatalf("Error: Request %d was rate limited within the burst", i+1)
+		}
+	}
+	if remaining := resolveFrom(handler, randomTestIP()+":41234", "").Header().Get("RateLimit-Remaining"); remaining != fmt.Sprint(burst-1) {
+		t.Errorf("Error: Wrong RateLimit-Remaining of a new client: got %v want %v", remaining, burst-1)
+	}
+
+	rr := resolveFrom(handler, client, "")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Error: No Retry-After header")
+	}
+	if rr.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Error: Wrong RateLimit-Remaining: got %v want %v", rr.Header().Get("RateLimit-Remaining"), 0)
+	}
+}
+
+func TestRateLimitTrustedProxy(t *testing.T) {
+	logger.New()
+	config.Read()
+	conf := config.Get()
+	handler := New().Handler
+
+	// 10.0.0.0/8 is trusted in the test configuration
+	proxy := "10.1.2.3:41234"
+	client := randomTestIP()
+
+	for i := 0; i < int(conf.RateLimit.Resolve.Burst); i++ {
+		resolveFrom(handler, proxy, "203.0.113.9, "+client+", 10.4.5.6")
+	}
+
+	// The client is limited, its forged addresses and other clients of the proxy are not
+	rr := resolveFrom(handler, proxy, client)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+	rr = resolveFrom(handler, proxy, randomTestIP())
+	if rr.Code == http.StatusTooManyRequests {
+		t.Errorf("Error: Another client of the proxy was rate limited")
+	}
+
+	// Untrusted clients can't choose their address with X-Forwarded-For
+	untrusted := randomTestIP() + ":41234"
+	for i := 0; i < int(conf.RateLimit.Resolve.Burst); i++ {
+		resolveFrom(handler, untrusted, randomTestIP())
+	}
+	rr = resolveFrom(handler, untrusted, randomTestIP())
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimitBeforeAuth(t *testing.T) {
+	logger.New()
+	config.Read()
+	conf := config.Get()
+	handler := New().Handler
+
+	// Guessed api keys are limited like any other request of the client
+	client := randomTestIP() + ":41234"
+	guess := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/short", strings.NewReader(`{"url":"http://www.testsite1.com"}`))
+		req.RemoteAddr = client
+		req.Header.Set("X-API-Key", fmt.Sprintf("guess-%d", testRand.Int()))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < int(conf.RateLimit.Shorten.Burst); i++ {
+		if rr := guess(); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+		}
+	}
+	if rr := guess(); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusTooManyRequests)
+	}
+}
@@ -1,7 +1,11 @@
 package routes
 
 import (
-	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/events"
+	"ilmavridis/url-shortener/helpers"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/metrics"
+	"ilmavridis/url-shortener/policy"
 	"ilmavridis/url-shortener/redisStorage"
 
 	"encoding/json"
@@ -11,6 +15,7 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
+	"go.uber.org/zap"
 )
 
 // Returns a simple html page with further info and instructions for our service
@@ -32,9 +37,7 @@ func ReturnImage(w http.ResponseWriter, r *http.Request) {
 	fileBytes, err := ioutil.ReadFile(imagePath)
 	if err != nil {
 		// Encode Http response in json
-		jsonResp, _ := json.Marshal(map[string]string{"error": "getting images"})
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		w.Write(jsonResp)
+		jsonError(w, r, http.StatusInternalServerError, "getting images")
 		return
 	}
 	w.Header().Set("Cache-Control", "public, max-age=7776000")
@@ -46,94 +49,297 @@ func ReturnImage(w http.ResponseWriter, r *http.Request) {
 
 // Resolves short url
 func ResolveUrl(w http.ResponseWriter, r *http.Request) {
-	conf := config.Get()
-	err := redisStorage.CreateClient()
-	if err != nil {
-		// Encodes Http response in json
-		jsonResp, _ := json.Marshal(map[string]string{"error": "create redis client"})
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		w.Write(jsonResp)
-		return
-	}
 	redisClient := redisStorage.Get()
-	defer redisClient.Close()
-
-	shortUrl := mux.Vars(r)
-	longUrl, err := redisClient.Get(redisStorage.Ctx, shortUrl["shortUrl"]).Result()
 
 	// Sets header to return response in json
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
+	shortUrl := mux.Vars(r)
+	key, err := redisStorage.ResolveKey(r.Context(), shortUrl["shortUrl"])
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+	longUrl, err := redisClient.Get(r.Context(), key).Result()
+
 	if err == redis.Nil {
-		jsonResp, _ := json.Marshal(map[string]string{"error": "short url not found"})
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		w.Write(jsonResp)
+		metrics.NotFound.Inc()
+		// Expired short urls keep their fallback url for a while
+		if redirectToFallback(w, r, key) {
+			return
+		}
+		jsonError(w, r, http.StatusBadRequest, "short url not found")
 		return
 	} else if err != nil {
-		jsonResp, _ := json.Marshal(map[string]string{"error": "conntecting to redis"})
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		w.Write(jsonResp)
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	// Destinations blocked after the short url was created stop redirecting
+	if err := policy.Check(longUrl); err != nil {
+		policyError(w, r, err)
+		return
+	}
+
+	link, err := redisStorage.GetLink(r.Context(), key)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	// Only the password prompt posts to a short url, the redirect would make clients post to the destination
+	if r.Method == http.MethodPost && link.PasswordHash == "" {
+		w.Header().Set("Allow", http.MethodGet)
+		jsonError(w, r, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// Only short urls with path passthrough have path segments after them
+	rest := shortUrl["rest"]
+	if rest != "" && (link.Passthrough == nil || !link.Passthrough.Path) {
+		My404Handler(w, r)
+		return
+	}
+
+	// Short urls flagged by the scanner show a warning instead of redirecting
+	if link.Disabled {
+		if redirectToFallback(w, r, key) {
+			return
+		}
+		renderPage(w, r, http.StatusForbidden, "warning.html", map[string]string{
+			"Short":  shortUrl["shortUrl"],
+			"Threat": link.Threat,
+		})
 		return
 	}
 
-	http.Redirect(w, r, longUrl, http.StatusPermanentRedirect)
+	if !checkActiveWindow(w, r, key, link) {
+		return
+	}
+
+	// Link unfurlers get the card of the short url instead of the redirect, which is not a click.
+	// It is served before the password check and doesn't show the destination.
+	if link.OpenGraph != nil {
+		w.Header().Add("Vary", "User-Agent")
+		if isCrawler(r.UserAgent()) {
+			renderPage(w, r, http.StatusOK, "open_graph.html", link.OpenGraph)
+			return
+		}
+	}
+
+	if link.PasswordHash != "" && !checkLinkPassword(w, r, key, link) {
+		return
+	}
+
+	target, variant := targetUrl(w, r, shortUrl["shortUrl"], longUrl, link)
+	destination, err := passthroughUrl(target, link.Passthrough, rest, r.URL.Query())
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "building destination url")
+		return
+	}
+	// The destination of the client and the appended path and query can make a url that the policy blocks
+	if destination != longUrl {
+		if err := policy.Check(destination); err != nil {
+			policyError(w, r, err)
+			return
+		}
+	}
+
+	// Single-use and limited short urls stop working after their last click
+	if link.MaxClicks > 0 {
+		ok, err := redisStorage.UseClick(r.Context(), key)
+		if err != nil {
+			jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+			return
+		} else if !ok {
+			if redirectToFallback(w, r, key) {
+				return
+			}
+			jsonError(w, r, http.StatusGone, "short url has no clicks left")
+			return
+		}
+	}
+
+	// Browsers cache permanent redirects, so short urls that are checked on every click get another one.
+	// It also makes the browsers that posted the password get the destination instead of posting to it.
+	if !cacheableRedirect(link) || r.Method == http.MethodPost {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, destination, http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, destination, http.StatusPermanentRedirect)
+	}
+	metrics.Resolved.Inc()
+
+	trackClick(r, key, longUrl, variant)
 
 	// Resets redis ttl for this key/shortUrl
-	err = redisClient.Expire(redisStorage.Ctx, shortUrl["shortUrl"], conf.Redis.Expiry).Err()
+	expiry := linkExpiry(link)
+	err = redisClient.Expire(r.Context(), key, expiry).Err()
+	if err == nil {
+		err = redisStorage.ExpireLink(r.Context(), key, link, expiry)
+	}
 	if err != nil {
-		jsonResp, _ := json.Marshal(map[string]string{"error": "failed to reset ttl"})
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		w.Write(jsonResp)
+		jsonError(w, r, http.StatusInternalServerError, "failed to reset ttl")
 		return
 	}
 
 	return
 }
 
+// Returns the destination of a short url for the client and its variant: the one of its device rules,
+// otherwise the one of its country or language rules, otherwise the one of its variants, otherwise the long url
+func targetUrl(w http.ResponseWriter, r *http.Request, shortUrl string, longUrl string, link redisStorage.Link) (string, string) {
+	if destination, ok := deviceUrl(r, link); ok {
+		return destination, ""
+	}
+	if destination, ok := countryUrl(r, link); ok {
+		return destination, ""
+	}
+	if destination, ok := languageUrl(r, link); ok {
+		return destination, ""
+	}
+	if variant, ok := pickVariant(w, r, shortUrl, link); ok {
+		return variant.Url, variant.Name
+	}
+	return longUrl, ""
+}
+
+// Returns whether clients can cache the redirect of a short url, which is only the case
+// when it redirects every client to the same destination for as long as it exists
+func cacheableRedirect(link redisStorage.Link) bool {
+	return link.PasswordHash == "" && link.MaxClicks == 0 && link.ActiveUntil == nil &&
+		len(link.DeviceRules) == 0 && len(link.CountryRules) == 0 && len(link.LanguageRules) == 0 && len(link.Variants) == 0
+}
+
+// Returns the info of a protected short url without its url, its other destinations
+// and anything that is derived from them
+func redactedResponse(resp response) response {
+	return response{
+		CustomShort: resp.CustomShort,
+		ExpiresIn:   resp.ExpiresIn,
+		CreatedBy:   resp.CreatedBy,
+		Workspace:   resp.Workspace,
+		Disabled:    resp.Disabled,
+		Threat:      resp.Threat,
+
+		PasswordProtected: resp.PasswordProtected,
+		MaxClicks:         resp.MaxClicks,
+		ClicksLeft:        resp.ClicksLeft,
+		ActiveFrom:        resp.ActiveFrom,
+		ActiveUntil:       resp.ActiveUntil,
+	}
+}
+
+// Stores the click for analytics and exports it to the configured message broker.
+// The redirect has already been sent, so failures are only logged.
+func trackClick(r *http.Request, key string, longUrl string, variant string) {
+	click := redisStorage.Click{
+		Timestamp: time.Now(),
+		RemoteIP:  helpers.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Referer:   r.Referer(),
+		Variant:   variant,
+	}
+	if err := redisStorage.RecordClick(r.Context(), key, click); err != nil {
+		logger.FromContext(r.Context()).Error("Could not record click", zap.Error(err))
+	}
+
+	event := events.ClickEvent{
+		ShortUrl:  redisStorage.ShortUrlOf(key),
+		Url:       longUrl,
+		Timestamp: click.Timestamp,
+		RemoteIP:  click.RemoteIP,
+		UserAgent: click.UserAgent,
+		Referer:   click.Referer,
+		Variant:   click.Variant,
+	}
+	if err := events.Get().Publish(r.Context(), event); err != nil {
+		logger.FromContext(r.Context()).Error("Could not publish click event", zap.Error(err))
+	}
+}
+
 // Returns information for this key/shortUrl
 func Info(w http.ResponseWriter, r *http.Request) {
 
-	err := redisStorage.CreateClient()
-	if err != nil {
-		jsonResp, _ := json.Marshal(map[string]string{"error": "create redis client"})
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		w.Write(jsonResp)
-		return
-	}
 	redisClient := redisStorage.Get()
-	defer redisClient.Close()
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
 	shortUrl := mux.Vars(r)
-	longUrl, err := redisClient.Get(redisStorage.Ctx, shortUrl["shortUrl"]).Result()
+	key, err := redisStorage.ResolveKey(r.Context(), shortUrl["shortUrl"])
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+	longUrl, err := redisClient.Get(r.Context(), key).Result()
 
 	if err == redis.Nil {
-		jsonResp, _ := json.Marshal(map[string]string{"error": "short url not found"})
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		w.Write(jsonResp)
+		jsonError(w, r, http.StatusBadRequest, "short url not found")
 		return
 	} else if err != nil {
-		jsonResp, _ := json.Marshal(map[string]string{"error": "conntecting to redis"})
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		w.Write(jsonResp)
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
 		return
 	}
 
 	// Gets ttl for this this key/shortUrl
-	ttl, err := redisClient.TTL(redisStorage.Ctx, shortUrl["shortUrl"]).Result()
+	ttl, err := redisClient.TTL(r.Context(), key).Result()
+
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
 
+	link, err := redisStorage.GetLink(r.Context(), key)
 	if err != nil {
-		jsonResp, _ := json.Marshal(map[string]string{"error": "conntecting to redis"})
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		w.Write(jsonResp)
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(response{longUrl, shortUrl["shortUrl"], time.Duration(ttl.Seconds())}); err != nil {
-		jsonResp, _ := json.Marshal(map[string]string{"error": "encoding response in json"})
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		w.Write(jsonResp)
+	// Short urls of other workspaces are reported as missing
+	if !canSee(r, link) {
+		jsonError(w, r, http.StatusBadRequest, "short url not found")
+		return
+	}
+
+	resp := response{
+		Url:         longUrl,
+		CustomShort: shortUrl["shortUrl"],
+		ExpiresIn:   time.Duration(ttl.Seconds()),
+		CreatedBy:   link.CreatedBy,
+		Workspace:   link.Workspace,
+		Disabled:    link.Disabled,
+		Threat:      link.Threat,
+
+		PasswordProtected: link.PasswordHash != "",
+		MaxClicks:         link.MaxClicks,
+		ActiveFrom:        link.ActiveFrom,
+		ActiveUntil:       link.ActiveUntil,
+		Passthrough:       link.Passthrough,
+		DeviceRules:       link.DeviceRules,
+		CountryRules:      link.CountryRules,
+		LanguageRules:     link.LanguageRules,
+		Variants:          link.Variants,
+		OpenGraph:         link.OpenGraph,
+	}
+	resp.FallbackUrl, err = redisStorage.GetFallback(r.Context(), key)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+	if link.MaxClicks > 0 {
+		clicksLeft, err := redisStorage.GetClicksLeft(r.Context(), key)
+		if err != nil {
+			jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+			return
+		}
+		resp.ClicksLeft = &clicksLeft
+	}
+	// The destinations of a protected short url are only disclosed to those who can manage it
+	if resp.PasswordProtected && !canManage(r, link) {
+		resp = redactedResponse(resp)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "encoding response in json")
 		return
 	}
 
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
 	"ilmavridis/url-shortener/redisStorage"
 
 	"encoding/json"
@@ -10,6 +11,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/uuid"
@@ -19,9 +21,7 @@ import (
 func addRedisKeyValue(shortURL string, URL string) {
 	conf := config.Get()
 
-	redisStorage.CreateClient()
 	redisClient := redisStorage.Get()
-	defer redisClient.Close()
 
 	redisClient.Set(redisStorage.Ctx, shortURL, URL, conf.Redis.Expiry)
 }
@@ -58,8 +58,6 @@ func TestResolveURL(t *testing.T) {
 		t.Errorf("Error at creating redis client: %v", err)
 		return
 	}
-	redisClient := redisStorage.Get()
-	defer redisClient.Close()
 
 	for _, request := range requests {
 		path := fmt.Sprintf("/%s", request.CustomShort)
@@ -105,8 +103,6 @@ func TestResolveURLNotFound(t *testing.T) {
 		t.Errorf("Error at creating redis client: %v", err)
 		return
 	}
-	redisClient := redisStorage.Get()
-	defer redisClient.Close()
 
 	path := fmt.Sprintf("/%s", nonExistedURLRequest.CustomShort)
 	req, err := http.NewRequest("GET", path, nil)
@@ -164,8 +160,6 @@ func TestInfo(t *testing.T) {
 		t.Errorf("Error at creating redis client: %v", err)
 		return
 	}
-	redisClient := redisStorage.Get()
-	defer redisClient.Close()
 
 	for _, request := range requests {
 		path := fmt.Sprintf("/info/%s", request.CustomShort)
@@ -216,8 +210,6 @@ func TestInfoURLNotFound(t *testing.T) {
 		t.Errorf("Error at creating redis client: %v", err)
 		return
 	}
-	redisClient := redisStorage.Get()
-	defer redisClient.Close()
 
 	path := fmt.Sprintf("/info/%s", nonExistedURLRequest.CustomShort)
 	req, err := http.NewRequest("GET", path, nil)
@@ -262,3 +254,34 @@ func TestResolveUrlhome(t *testing.T) {
 	}
 
 }
+
+// Handlers share one redis client, so concurrent requests don't close it for each other
+func TestResolveURLConcurrent(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	shortenTestUrl(t, request{Url: "http://www.testsite1.com", CustomShort: "concurrent0"})
+	defer deleteTestLink("concurrent0")
+
+	clients := make([]string, 20)
+	for i := range clients {
+		clients[i] = randomTestIP() + ":41234"
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, len(clients))
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client string) {
+			defer wg.Done()
+			codes[i] = clickTestUrl(handler, "concurrent0", client, nil).Code
+		}(i, client)
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		if code != http.StatusPermanentRedirect {
+			t.Errorf("Error: Handler returned wrong status code: got %v want %v", code, http.StatusPermanentRedirect)
+		}
+	}
+}
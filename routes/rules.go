@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"sort"
+)
+
+// Returns the keys of device, country or language rules in order, so the same rules are always
+// validated in the same order, reporting the same error, and matched the same way
+func sortedRuleKeys(rules map[string]string) []string {
+	keys := make([]string, 0, len(rules))
+	for key := range rules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+	"ilmavridis/url-shortener/scanner"
+
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestScanner(t *testing.T) {
+	logger.New()
+	config.Read()
+	if err := scanner.Init(); err != nil {
+		t.Fatalf("Error at setting up url scanning: %v", err)
+	}
+	handler := New().Handler
+	defer deleteTestLink("scan0")
+	defer deleteTestLink("scan1")
+	defer deleteTestLink("scan2")
+	defer deleteTestLink("scan3")
+	defer deleteTestLink("scan4")
+
+	// Flagged urls can't be shortened
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://malware.example.com/download"}`, nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	var m struct {
+		Scan struct {
+			Threat string
+		}
+	}
+	json.Unmarshal([]byte(strings.Split(rr.Body.String(), "\n")[1]), &m)
+	if m.Scan.Threat != "MALWARE" {
+		t.Errorf("Error: Wrong threat: got %q want %q", m.Scan.Threat, "MALWARE")
+	}
+
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"scan0"}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var created response
+	json.Unmarshal(rr.Body.Bytes(), &created)
+
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"scan1","fallback_url":"http://www.testsite2.com"}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"scan3","device_rules":{"ios":"http://www.testsite2.com"}}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"scan4","variants":[{"url":"http://www.testsite2.com","weight":1},{"url":"http://www.testsite3.com","weight":1}]}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Destinations flagged after the short url was created are disabled by the periodic scan
+	addRedisKeyValue("scan0", "http://phishing.example.org/login")
+	// and flagged fallback urls are removed
+	addRedisKeyValue("fallback:scan1", "http://malware.example.com/download")
+	// Short urls created before metadata was introduced are scanned too
+	addRedisKeyValue("scan2", "http://malware.example.com/download")
+	// as are the destinations of rules and variants
+	for short, flag := range map[string]func(*redisStorage.Link){
+		"scan3": func(link *redisStorage.Link) { link.DeviceRules["ios"] = "http://malware.example.com/download" },
+		"scan4": func(link *redisStorage.Link) { link.Variants[1].Url = "http://phishing.example.org/login" },
+	} {
+		link, err := redisStorage.GetLink(context.Background(), short)
+		if err != nil {
+			t.Fatalf("Error at reading short url %s: %v", short, err)
+		}
+		flag(&link)
+		redisStorage.SaveLink(context.Background(), short, link, 0)
+	}
+	client, err := redisStorage.NewClient()
+	if err != nil {
+		t.Fatalf("Error at connecting to redis: %v", err)
+	}
+	defer client.Close()
+	if _, err := scanner.ScanLinks(context.Background(), client); err != nil {
+		t.Fatalf("Error at scanning short urls: %v", err)
+	}
+
+	rr = serveTestRequest(handler, "GET", "/scan0", "", nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") || !strings.Contains(rr.Body.String(), "SOCIAL_ENGINEERING") {
+		t.Errorf("Error: Expected a warning page, got %q", rr.Body.String())
+	}
+
+	rr = serveTestRequest(handler, "GET", "/info/scan0", "", nil)
+	var info response
+	json.Unmarshal(rr.Body.Bytes(), &info)
+	if !info.Disabled || info.Threat != "SOCIAL_ENGINEERING" {
+		t.Errorf("Error: Expected a disabled short url, got %+v", info)
+	}
+
+	rr = serveTestRequest(handler, "GET", "/info/scan1", "", nil)
+	info = response{}
+	json.Unmarshal(rr.Body.Bytes(), &info)
+	if info.Disabled || info.FallbackUrl != "" {
+		t.Errorf("Error: Expected an enabled short url without fallback url, got %+v", info)
+	}
+
+	rr = serveTestRequest(handler, "GET", "/scan2", "", nil)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	for short, threat := range map[string]string{"scan3": "MALWARE", "scan4": "SOCIAL_ENGINEERING"} {
+		rr = serveTestRequest(handler, "GET", "/info/"+short, "", nil)
+		info = response{}
+		json.Unmarshal(rr.Body.Bytes(), &info)
+		if !info.Disabled || info.Threat != threat {
+			t.Errorf("Error: Expected a disabled short url %s, got %+v", short, info)
+		}
+	}
+
+	// A new url that passes the scanners enables the short url again
+	owner := map[string]string{"X-Owner-Token": created.OwnerToken}
+	rr = serveTestRequest(handler, "PATCH", "/short/scan0", `{"url":"http://www.testsite2.com"}`, owner)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = serveTestRequest(handler, "GET", "/scan0", "", nil)
+	if rr.Code != http.StatusPermanentRedirect {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusPermanentRedirect)
+	}
+}
@@ -1,30 +1,57 @@
 package routes
 
 import (
+	"ilmavridis/url-shortener/auth"
 	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/helpers"
+	"ilmavridis/url-shortener/logger"
 	"ilmavridis/url-shortener/middleware"
 
 	"context"
-	"encoding/json"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Configures router and returns server
 func New() *http.Server {
 
-	router := mux.NewRouter()
+	conf := config.Get()
+
+	// The IP of clients behind trusted proxies is read from X-Forwarded-For.
+	// The server doesn't start with invalid ones, clients would share the address of the proxy.
+	if err := helpers.SetTrustedProxies(conf.Server.TrustedProxies); err != nil {
+		logger.Fatal("Invalid trusted proxies: ", err)
+	}
 
-	router.HandleFunc("/", middleware.Logger(home)).Methods("GET")
-	router.HandleFunc("/images/{imageName}", middleware.Logger(ReturnImage)).Methods("GET") // Returns images required from home handler for html page
-	router.HandleFunc("/info/{shortUrl}", middleware.Logger(Info)).Methods("GET")
-	router.HandleFunc("/short", middleware.Logger(ShortenUrl)).Methods("POST")
-	router.HandleFunc("/{shortUrl}", middleware.Logger(ResolveUrl)).Methods("GET")
-	router.NotFoundHandler = middleware.Logger(My404Handler)
+	router := mux.NewRouter()
 
-	conf := config.Get()
+	router.HandleFunc("/", handle(home)).Methods("GET")
+	router.HandleFunc("/images/{imageName}", handle(ReturnImage)).Methods("GET") // Returns images required from home handler for html page
+	router.HandleFunc("/info/{shortUrl}", handle(middleware.RequireScope(auth.ScopeReadInfo, Info))).Methods("GET")
+	router.HandleFunc("/short", handleLimited(middleware.RateLimitShorten, middleware.RequireScope(auth.ScopeCreate, ShortenUrl))).Methods("POST")
+	router.HandleFunc("/short/{shortUrl}", handle(middleware.RequireScope(auth.ScopeManage, UpdateUrl))).Methods("PATCH")
+	router.HandleFunc("/short/{shortUrl}", handle(middleware.RequireScope(auth.ScopeManage, DeleteUrl))).Methods("DELETE")
+	router.HandleFunc("/stats/{shortUrl}", handle(middleware.RequireScope(auth.ScopeManage, Stats))).Methods("GET")
+	router.HandleFunc("/stats/{shortUrl}/export", handle(middleware.RequireScope(auth.ScopeManage, ExportStats))).Methods("GET")
+	router.HandleFunc("/quota", handle(QuotaUsage)).Methods("GET")
+	router.HandleFunc("/admin/keys", handle(middleware.RequireScope(auth.ScopeAdmin, CreateAPIKey))).Methods("POST")
+	router.HandleFunc("/admin/keys", handle(middleware.RequireScope(auth.ScopeAdmin, ListAPIKeys))).Methods("GET")
+	router.HandleFunc("/admin/keys/{id}", handle(middleware.RequireScope(auth.ScopeAdmin, RevokeAPIKey))).Methods("DELETE")
+	router.HandleFunc("/admin/workspaces", handle(middleware.RequireScope(auth.ScopeAdmin, CreateWorkspace))).Methods("POST")
+	router.HandleFunc("/admin/workspaces", handle(middleware.RequireScope(auth.ScopeAdmin, ListWorkspaces))).Methods("GET")
+	router.HandleFunc("/admin/workspaces/{id}", handle(middleware.RequireScope(auth.ScopeAdmin, GetWorkspace))).Methods("GET")
+	router.HandleFunc("/admin/workspaces/{id}", handle(middleware.RequireScope(auth.ScopeAdmin, UpdateWorkspace))).Methods("PATCH")
+	if conf.Metrics.Enabled {
+		router.Handle("/metrics", promhttp.Handler()).Methods("GET") // Not logged, it is scraped every few seconds
+	}
+	router.HandleFunc("/preview/{shortUrl}", handleLimited(middleware.RateLimitResolve, PreviewUrl)).Methods("GET")
+	router.HandleFunc("/{shortUrl:[^/]+}+", handleLimited(middleware.RateLimitResolve, PreviewUrl)).Methods("GET")
+	router.HandleFunc("/{shortUrl}", handleLimited(middleware.RateLimitResolve, ResolveUrl)).Methods("GET", "POST")           // POST for the password prompt
+	router.HandleFunc("/{shortUrl}/{rest:.*}", handleLimited(middleware.RateLimitResolve, ResolveUrl)).Methods("GET", "POST") // Path passthrough
+	router.NotFoundHandler = handle(My404Handler)
 
 	srv := &http.Server{
 		Addr: conf.Server.Address,
@@ -39,6 +66,17 @@ func New() *http.Server {
 	return srv
 }
 
+// Wraps a handler with the middleware chain shared by all routes
+func handle(h http.HandlerFunc) http.HandlerFunc {
+	return middleware.RequestID(middleware.Tracing(middleware.Logger(middleware.Metrics(middleware.Auth(h)))))
+}
+
+// Wraps a rate limited handler with the middleware chain shared by all routes.
+// The rate limit is taken before the client is authenticated, so guessing credentials is limited too.
+func handleLimited(policy string, h http.HandlerFunc) http.HandlerFunc {
+	return middleware.RequestID(middleware.Tracing(middleware.Logger(middleware.Metrics(middleware.RateLimit(policy, middleware.Auth(h))))))
+}
+
 // Runs the server as a goroutine
 func Run(srv *http.Server) <-chan error {
 	errChannel := make(chan error)
@@ -72,8 +110,6 @@ func My404Handler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
 	// Returns response in json
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	jsonResp, _ := json.Marshal(map[string]string{"error": "404 page not found"})
-
-	w.Write(jsonResp)
+	w.Write(middleware.ErrorBody(r, "404 page not found"))
 	return
 }
@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMetrics(t *testing.T) {
+	logger.New()
+	config.Read()
+	srv := New()
+
+	// A request for a route template, so that the http metrics have a series
+	req, _ := http.NewRequest("GET", "/info/foo123", nil)
+	srv.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Errorf("Error at creating http request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	body := rr.Body.String()
+	for _, metric := range []string{
+		`http_requests_total{method="GET",route="/info/{shortUrl}",status="4xx"}`,
+		"redis_command_duration_seconds",
+		"shortener_shortened_total",
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, metric) {
+			t.Errorf("Error: metric %v is not exported", metric)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	logger.New()
+	config.Read()
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	srv := New()
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest("GET", "/info/foo123", nil)
+	if err != nil {
+		t.Errorf("Error at creating http request: %v", err)
+	}
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	srv.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	names := map[string]bool{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() != traceID {
+			t.Errorf("Error: span %v does not continue the trace of the client", span.Name())
+		}
+		names[span.Name()] = true
+	}
+
+	if !names["GET /info/{shortUrl}"] {
+		t.Errorf("Error: no span for the request: got %v", names)
+	}
+	if !names["redis get"] {
+		t.Errorf("Error: no child span for the redis command: got %v", names)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	logger.New()
+	config.Read()
+	srv := New()
+
+	// The request id of the client is echoed
+	req, _ := http.NewRequest("GET", "/info/foo123", nil)
+	req.Header.Set("X-Request-ID", "client-request-1")
+	rr := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rr, req)
+
+	if requestID := rr.Header().Get("X-Request-ID"); requestID != "client-request-1" {
+		t.Errorf("Error: Wrong request id: got %v want %v", requestID, "client-request-1")
+	}
+
+	bodyString := strings.Split(rr.Body.String(), "\n")[1]
+	if bodyString != "{\"error\":\"short url not found\",\"request_id\":\"client-request-1\"}" {
+		t.Errorf("Error: Error body does not contain the request id. Got %v", bodyString)
+	}
+
+	// A request id is generated when the client does not send one
+	req, _ = http.NewRequest("GET", "/info/foo123", nil)
+	rr = httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("X-Request-ID") == "" {
+		t.Errorf("Error: No request id generated")
+	}
+}
@@ -1,81 +1,188 @@
 package routes
 
 import (
+	"ilmavridis/url-shortener/auth"
 	"ilmavridis/url-shortener/config"
 	"ilmavridis/url-shortener/helpers"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/metrics"
+	"ilmavridis/url-shortener/middleware"
+	"ilmavridis/url-shortener/policy"
 	"ilmavridis/url-shortener/redisStorage"
+	"ilmavridis/url-shortener/scanner"
 
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
 	"time"
 
 	"github.com/asaskevich/govalidator"
-	"github.com/go-redis/redis/v8"
 	"github.com/golang/gddo/httputil/header"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
 type request struct {
-	Url         string `json:"url"`
-	CustomShort string `json:"short"`
+	Url         string     `json:"url"`
+	CustomShort string     `json:"short"`
+	Password    string     `json:"password,omitempty"`   // Needed to resolve the short url
+	MaxClicks   int64      `json:"max_clicks,omitempty"` // The short url stops redirecting after them, e.g. 1 for single-use links
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+	FallbackUrl string     `json:"fallback_url,omitempty"` // Used when the short url is expired, disabled or exhausted
+
+	Passthrough *redisStorage.Passthrough `json:"passthrough,omitempty"`
+
+	UTM         *redisStorage.UTM `json:"utm,omitempty"`          // Added to the url
+	UTMTemplate string            `json:"utm_template,omitempty"` // Name of a UTM template of the workspace, added to the url
+
+	DeviceRules  map[string]string `json:"device_rules,omitempty"`  // Destinations by device class (ios, android, desktop)
+	CountryRules map[string]string `json:"country_rules,omitempty"` // Destinations by ISO 3166-1 alpha-2 country code
+
+	LanguageRules map[string]string `json:"language_rules,omitempty"` // Destinations by BCP 47 language tag, matched with Accept-Language
+
+	Variants []redisStorage.Variant `json:"variants,omitempty"` // Destinations that split the traffic by their weights
+
+	OpenGraph *redisStorage.OpenGraph `json:"open_graph,omitempty"` // Title, description and image that link unfurlers show
 }
 
 type response struct {
 	Url         string        `json:"url"`
 	CustomShort string        `json:"short"`
 	ExpiresIn   time.Duration `json:"expires_in_seconds"`
+	OwnerToken  string        `json:"owner_token,omitempty"` // Only returned when the short url is created
+	CreatedBy   string        `json:"created_by,omitempty"`
+	Workspace   string        `json:"workspace,omitempty"`
+	Disabled    bool          `json:"disabled,omitempty"`
+	Threat      string        `json:"threat,omitempty"`
+
+	PasswordProtected bool   `json:"password_protected,omitempty"`
+	MaxClicks         int64  `json:"max_clicks,omitempty"`
+	ClicksLeft        *int64 `json:"clicks_left,omitempty"` // Only for short urls with max_clicks
+
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+	FallbackUrl string     `json:"fallback_url,omitempty"`
+
+	Passthrough  *redisStorage.Passthrough `json:"passthrough,omitempty"`
+	DeviceRules  map[string]string         `json:"device_rules,omitempty"`
+	CountryRules map[string]string         `json:"country_rules,omitempty"`
+
+	LanguageRules map[string]string `json:"language_rules,omitempty"`
+
+	Variants []redisStorage.Variant `json:"variants,omitempty"`
+
+	OpenGraph *redisStorage.OpenGraph `json:"open_graph,omitempty"`
+}
+
+// Short urls are path segments and their names are part of the keys they are stored under
+var customShort = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Short urls that would be shadowed by other routes of the service
+var reservedShortUrls = map[string]bool{
+	"metrics": true,
+	"quota":   true,
+	"stats":   true,
+	"preview": true,
+	// The paths after them, see path passthrough, are routes of the service
+	"info":   true,
+	"short":  true,
+	"admin":  true,
+	"images": true,
+	// Keys of the service that share the keyspace of short urls without a workspace
+	"apikeys":       true,
+	"workspaces":    true,
+	"preview-queue": true,
 }
 
 func ShortenUrl(w http.ResponseWriter, r *http.Request) {
 	conf := config.Get()
 
-	err := redisStorage.CreateClient()
-	if err != nil {
-		// Encodes Http response in json
-		jsonResp, _ := json.Marshal(map[string]string{"error": "create redis client"}) //response to json
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		w.Write(jsonResp)
-		return
-	}
 	redisClient := redisStorage.Get()
-	defer redisClient.Close()
 
 	body := new(request)
+	if !decodeJSON(w, r, body) {
+		return
+	}
 
-	// Checks if there is the Content-Type header and has the value application/json.
-	if r.Header.Get("Content-Type") != "" {
-		value, _ := header.ParseValueAndParams(r.Header, "Content-Type")
-		if value != "application/json" {
-			msg := "Content-Type header is not application/json"
-			http.Error(w, msg, http.StatusUnsupportedMediaType)
-			return
-		}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	// Short urls of a workspace follow its settings
+	workspace, ok := requestWorkspace(w, r)
+	if !ok {
+		return
 	}
 
-	// Json to struct
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	// UTM parameters become part of the stored url
+	utm, err := requestUTM(body, workspace)
+	if err != nil {
+		jsonError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
+	longUrl, conflicts, err := applyUTM(body.Url, utm)
+	if err != nil {
+		jsonError(w, r, http.StatusBadRequest, "invalid url")
+		return
+	} else if len(conflicts) > 0 {
+		middleware.JSONErrorWith(w, r, http.StatusBadRequest, "utm parameters conflict with the url", map[string]interface{}{
+			"conflicts": conflicts,
+		})
+		return
+	}
+	body.Url = longUrl
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if !validateUrl(w, r, body.Url, workspace) {
+		return
+	}
+	if body.FallbackUrl != "" && !validateUrl(w, r, body.FallbackUrl, workspace) {
+		return
+	}
+	if !validateDeviceRules(w, r, body.DeviceRules, workspace) {
+		return
+	}
+	if !validateCountryRules(w, r, body.CountryRules, workspace) {
+		return
+	}
+	if !validateLanguageRules(w, r, body.LanguageRules, workspace) {
+		return
+	}
+	if !validateVariants(w, r, body.Variants, workspace) {
+		return
+	}
+	if !validateOpenGraph(w, r, body.OpenGraph) {
+		return
+	}
+	if body.OpenGraph != nil && *body.OpenGraph == (redisStorage.OpenGraph{}) {
+		body.OpenGraph = nil
+	}
 
-	if !govalidator.IsURL(body.Url) {
-		jsonResp, _ := json.Marshal(map[string]string{"error": "invalid url"})
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		w.Write(jsonResp)
+	if body.MaxClicks < 0 {
+		jsonError(w, r, http.StatusBadRequest, "max_clicks can't be negative")
 		return
 	}
 
-	// Avoids entering in an infinite loop by checking if the url provided by the user is the service url
-	if !helpers.CheckDomain(body.Url, conf.Server.Address) {
-		jsonResp, _ := json.Marshal(map[string]string{"error": "you can't short the shortener!"})
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		w.Write(jsonResp)
+	if err := validateActiveWindow(body.ActiveFrom, body.ActiveUntil); err != nil {
+		jsonError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validatePassthrough(body.Passthrough); err != nil {
+		jsonError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	// Only the hash of the password is stored
+	var passwordHash string
+	if body.Password != "" {
+		passwordHash, err = hashPassword(body.Password)
+		if err != nil {
+			jsonError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
 	// The short url can be user-defined or it will be calulcated automatically
 	var shortUrl string
 	if body.CustomShort == "" {
@@ -84,38 +191,233 @@ func ShortenUrl(w http.ResponseWriter, r *http.Request) {
 		shortUrl = body.CustomShort
 	}
 
-	// Checks if the short url key is already taken
-	val, err := redisClient.Get(redisStorage.Ctx, shortUrl).Result()
-	if err != redis.Nil {
-		takenMessage := fmt.Sprintf("short url %s is already taken. Short %s with another one :)", shortUrl, val)
-		jsonResp, _ := json.Marshal(map[string]string{"error": takenMessage})
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		w.Write(jsonResp)
-		if err != nil {
-			jsonResp, _ := json.Marshal(map[string]string{"error": "conntecting to redis"})
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			w.Write(jsonResp)
-			return
-		}
+	if !customShort.MatchString(shortUrl) {
+		jsonError(w, r, http.StatusBadRequest, "short urls can only have up to 64 letters, digits, - and _")
+		return
+	}
+	// The stream of click events is named in the configuration
+	if reservedShortUrls[shortUrl] || shortUrl == conf.Events.Stream {
+		jsonError(w, r, http.StatusBadRequest, fmt.Sprintf("short url %s is reserved", shortUrl))
+		return
+	}
+
+	expiry := conf.Redis.Expiry
+	if workspace.Expiry() > 0 {
+		expiry = workspace.Expiry()
+	}
+	// Short urls that go live later must not expire before they are used
+	if body.ActiveFrom != nil && body.ActiveFrom.After(time.Now()) {
+		expiry += time.Until(*body.ActiveFrom)
+	}
+
+	// Short urls are unique across workspaces, they share the paths of the service
+	claimed, err := redisStorage.ClaimShortUrl(r.Context(), workspace.ID, shortUrl, expiry)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	} else if !claimed {
+		jsonError(w, r, http.StatusBadRequest, fmt.Sprintf("short url %s is already taken. Short your url with another one :)", shortUrl))
 		return
 	}
+	// The url and the rest of the short url are stored in the namespace of its workspace
+	key := redisStorage.LinkKey(workspace.ID, shortUrl)
 
-	// Sends the new entry to redis server
-	err = redisClient.Set(redisStorage.Ctx, shortUrl, body.Url, conf.Redis.Expiry).Err()
+	// The owner token is needed to manage the short url later
+	ownerToken, err := newOwnerToken()
 	if err != nil {
-		jsonResp, _ := json.Marshal(map[string]string{"error": "conntecting to redis"})
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		w.Write(jsonResp)
+		releaseShortUrl(r, shortUrl)
+		jsonError(w, r, http.StatusInternalServerError, "generating owner token")
+		return
+	}
+	link := redisStorage.Link{
+		CreatedAt:      time.Now().UTC(),
+		OwnerTokenHash: auth.HashToken(ownerToken),
+		Workspace:      workspace.ID,
+		Expiry:         workspace.Expiry(),
+		PasswordHash:   passwordHash,
+		MaxClicks:      body.MaxClicks,
+		ActiveFrom:     body.ActiveFrom,
+		ActiveUntil:    body.ActiveUntil,
+		Passthrough:    body.Passthrough,
+		DeviceRules:    body.DeviceRules,
+		CountryRules:   body.CountryRules,
+		LanguageRules:  body.LanguageRules,
+		Variants:       body.Variants,
+		OpenGraph:      body.OpenGraph,
+	}
+	// Links created by an authenticated client can also be managed with its credentials
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		link.Owner = principal.ID
+		link.CreatedBy = principal.Name
+	}
+
+	// Counts the short url in the quotas of the client and its workspace
+	err = redisStorage.ReserveLink(r.Context(), requestQuotas(r, workspace), shortUrl, expiry)
+	if exceeded, ok := err.(*redisStorage.QuotaExceeded); ok {
+		releaseShortUrl(r, shortUrl)
+		quotaError(w, r, exceeded)
+		return
+	} else if err != nil {
+		releaseShortUrl(r, shortUrl)
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	// Sends the new entry to redis server with its metadata
+	err = redisClient.Set(r.Context(), key, body.Url, expiry).Err()
+	if err == nil {
+		err = redisStorage.SaveLink(r.Context(), key, link, expiry)
+	}
+	if err == nil && link.MaxClicks > 0 {
+		err = redisStorage.SetClicksLeft(r.Context(), key, link.MaxClicks, expiry)
+	}
+	if err == nil {
+		// Also removes the fallback url that an expired short url with the same key may have left
+		err = redisStorage.SetFallback(r.Context(), key, body.FallbackUrl, expiry)
+	}
+	if err == nil {
+		// The title and favicon of the preview page are fetched in the background
+		err = queuePreview(r, key, link)
+	}
+	if err != nil {
+		// The short url was not created, so it doesn't count in the quotas
+		if err := redisStorage.DeleteLink(r.Context(), key); err != nil {
+			logger.FromContext(r.Context()).Error("Could not delete the partially created short url", zap.Error(err))
+		}
+		if err := redisStorage.ReleaseLink(r.Context(), shortUrl, link); err != nil {
+			logger.FromContext(r.Context()).Error("Could not release the quota of the short url", zap.Error(err))
+		}
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
 		return
 	}
 
+	metrics.Shortened.Inc()
+
 	// Returns response in json
-	if err := json.NewEncoder(w).Encode(response{body.Url, shortUrl, time.Duration(conf.Redis.Expiry.Seconds())}); err != nil {
-		jsonResp, _ := json.Marshal(map[string]string{"error": "encoding response to json"})
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		w.Write(jsonResp)
+	resp := response{
+		Url:         body.Url,
+		CustomShort: shortUrl,
+		ExpiresIn:   time.Duration(expiry.Seconds()),
+		OwnerToken:  ownerToken,
+		Workspace:   workspace.ID,
+
+		PasswordProtected: passwordHash != "",
+		MaxClicks:         link.MaxClicks,
+		ActiveFrom:        link.ActiveFrom,
+		ActiveUntil:       link.ActiveUntil,
+		FallbackUrl:       body.FallbackUrl,
+		Passthrough:       link.Passthrough,
+		DeviceRules:       link.DeviceRules,
+		CountryRules:      link.CountryRules,
+		LanguageRules:     link.LanguageRules,
+		Variants:          link.Variants,
+		OpenGraph:         link.OpenGraph,
+	}
+	if link.MaxClicks > 0 {
+		resp.ClicksLeft = &link.MaxClicks
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "encoding response to json")
 		return
 	}
 
 	return
 }
+
+// Decodes the json body of the request into v.
+// On failure the error response is written and false is returned.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	// Checks if there is the Content-Type header and has the value application/json.
+	if r.Header.Get("Content-Type") != "" {
+		value, _ := header.ParseValueAndParams(r.Header, "Content-Type")
+		if value != "application/json" {
+			msg := "Content-Type header is not application/json"
+			http.Error(w, msg, http.StatusUnsupportedMediaType)
+			return false
+		}
+	}
+
+	// Json to struct
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return false
+	}
+
+	return true
+}
+
+// Checks the url that a short url of the workspace redirects to.
+// On failure the error response is written and false is returned.
+func validateUrl(w http.ResponseWriter, r *http.Request, longUrl string, workspace redisStorage.Workspace) bool {
+	conf := config.Get()
+
+	// Checked first, so javascript:, data: or file: urls are reported with the rule that blocks them
+	if err := policy.CheckScheme(longUrl); err != nil {
+		policyError(w, r, err)
+		return false
+	}
+
+	if !govalidator.IsURL(longUrl) {
+		jsonError(w, r, http.StatusBadRequest, "invalid url")
+		return false
+	}
+
+	// Avoids entering in an infinite loop by checking if the url provided by the user is the service url
+	if !helpers.CheckDomain(longUrl, conf.Server.Address) {
+		jsonError(w, r, http.StatusBadRequest, "you can't short the shortener!")
+		return false
+	}
+
+	// Checked before the lookups of the destination and the scanners
+	if !helpers.DomainAllowed(longUrl, workspace.AllowedDomains) {
+		jsonError(w, r, http.StatusBadRequest, fmt.Sprintf("workspace %s doesn't allow short urls to this domain", workspace.ID))
+		return false
+	}
+
+	if err := policy.Check(longUrl); err != nil {
+		policyError(w, r, err)
+		return false
+	}
+
+	// Urls that resolve to internal addresses could make the service fetch them
+	if err := policy.CheckDestination(r.Context(), longUrl); errors.Is(err, policy.ErrUnresolvable) {
+		jsonError(w, r, http.StatusBadRequest, "url host could not be resolved")
+		return false
+	} else if err != nil {
+		policyError(w, r, err)
+		return false
+	}
+
+	// A failing checker doesn't block short urls, the periodic scan checks them again
+	flagged, err := scanner.Get().Check(r.Context(), []string{longUrl})
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Could not scan url", zap.Error(err))
+	} else if threat, ok := flagged[longUrl]; ok {
+		middleware.JSONErrorWith(w, r, http.StatusForbidden, "url flagged as malicious", map[string]interface{}{
+			"scan": map[string]string{"threat": threat},
+		})
+		return false
+	}
+
+	return true
+}
+
+// Writes the error response of a url that the policy blocks, naming the rule so clients can tell why
+func policyError(w http.ResponseWriter, r *http.Request, err error) {
+	violation, ok := err.(*policy.Violation)
+	if !ok {
+		jsonError(w, r, http.StatusInternalServerError, "checking url policy")
+		return
+	}
+
+	middleware.JSONErrorWith(w, r, http.StatusForbidden, "url blocked by policy", map[string]interface{}{
+		"policy": map[string]string{"rule": violation.Rule},
+	})
+}
+
+// Releases the claim of a short url that was not created
+func releaseShortUrl(r *http.Request, shortUrl string) {
+	if err := redisStorage.ReleaseShortUrl(r.Context(), shortUrl); err != nil {
+		logger.FromContext(r.Context()).Error("Could not release the claim of the short url", zap.Error(err))
+	}
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
 	"ilmavridis/url-shortener/redisStorage"
 
 	"encoding/json"
@@ -23,9 +24,7 @@ func IsValidURLShortUUID(uuid string) bool {
 }
 
 func deleteRedisKey(key string) {
-	redisStorage.CreateClient()
 	redisClient := redisStorage.Get()
-	defer redisClient.Close()
 
 	redisClient.Del(redisStorage.Ctx, key)
 }
@@ -152,3 +151,17 @@ func TestShortenUrlShortServerURL(t *testing.T) {
 	}
 
 }
+
+// Names of keys of the service can't be taken by short urls, which would store a string over them
+func TestShortenUrlReservedKeys(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+
+	for _, reserved := range []string{"apikeys", "workspaces", "preview-queue", config.Get().Events.Stream} {
+		rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"`+reserved+`"}`, nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Error: Handler returned wrong status code for %s: got %v want %v", reserved, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
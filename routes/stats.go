@@ -0,0 +1,242 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/redisStorage"
+
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Number of clicks read from redis for every chunk written to the client
+const exportPageSize = 1000
+
+type variantStats struct {
+	redisStorage.Variant
+	Clicks int64 `json:"clicks"`
+}
+
+type statsResponse struct {
+	CustomShort string         `json:"short"`
+	Variants    []variantStats `json:"variants,omitempty"`
+}
+
+// Returns the clicks of every variant of a short url, only to clients that can manage it
+func Stats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	shortUrl := mux.Vars(r)["shortUrl"]
+	key, _, link, ok := manageableLink(w, r, shortUrl)
+	if !ok {
+		return
+	}
+
+	names := make([]string, len(link.Variants))
+	for i, variant := range link.Variants {
+		names[i] = variant.Name
+	}
+	clicks, err := redisStorage.VariantClicks(r.Context(), key, names)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	resp := statsResponse{CustomShort: shortUrl}
+	for i, variant := range link.Variants {
+		resp.Variants = append(resp.Variants, variantStats{Variant: variant, Clicks: clicks[i]})
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "encoding response in json")
+		return
+	}
+
+	return
+}
+
+// Exports the clicks of a short url as csv or json lines, only to clients that can manage it.
+// The response is streamed in chunks, so large exports are never held in memory.
+func ExportStats(w http.ResponseWriter, r *http.Request) {
+	shortUrl := mux.Vars(r)["shortUrl"]
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "jsonl" {
+		jsonError(w, r, http.StatusBadRequest, "format must be csv or jsonl")
+		return
+	}
+
+	aggregate := query.Get("aggregate")
+	if aggregate != "" && aggregate != "day" {
+		jsonError(w, r, http.StatusBadRequest, "aggregate must be day")
+		return
+	}
+
+	from, err := parseExportTime(query.Get("from"), time.Unix(0, 0), false)
+	if err != nil {
+		jsonError(w, r, http.StatusBadRequest, "invalid from date")
+		return
+	}
+	to, err := parseExportTime(query.Get("to"), time.Now(), true)
+	if err != nil {
+		jsonError(w, r, http.StatusBadRequest, "invalid to date")
+		return
+	}
+
+	key, _, _, ok := manageableLink(w, r, shortUrl)
+	if !ok {
+		return
+	}
+
+	exporter := newClickExporter(w, format, shortUrl, aggregate)
+	filename := fmt.Sprintf("%s-clicks.%s", shortUrl, format)
+	w.Header().Set("Content-Type", exporter.contentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	after := ""
+	for {
+		clicks, err := redisStorage.ClickRange(r.Context(), key, from, to, after, exportPageSize)
+		if err != nil {
+			// The status line is already sent, the client notices the truncated body
+			return
+		}
+
+		for _, click := range clicks {
+			exporter.add(click)
+		}
+		if err := exporter.flush(); err != nil {
+			return
+		}
+
+		if len(clicks) < exportPageSize {
+			break
+		}
+		after = clicks[len(clicks)-1].ID
+	}
+
+	exporter.finish()
+	exporter.flush()
+
+	return
+}
+
+// Accepts RFC3339 timestamps or plain dates. A plain "to" date includes the whole day.
+func parseExportTime(value string, fallback time.Time, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Millisecond)
+	}
+
+	return t, nil
+}
+
+// Writes clicks, or the number of clicks per day, in the requested format
+type clickExporter struct {
+	w         http.ResponseWriter
+	format    string
+	shortUrl  string
+	aggregate string
+	csv       *csv.Writer
+	json      *json.Encoder
+	day       string
+	dayClicks int
+}
+
+func newClickExporter(w http.ResponseWriter, format string, shortUrl string, aggregate string) *clickExporter {
+	e := &clickExporter{w: w, format: format, shortUrl: shortUrl, aggregate: aggregate}
+
+	if format == "csv" {
+		e.csv = csv.NewWriter(w)
+		if aggregate == "day" {
+			e.csv.Write([]string{"date", "short", "clicks"})
+		} else {
+			e.csv.Write([]string{"timestamp", "short", "remote_ip", "user_agent", "referer", "variant"})
+		}
+	} else {
+		e.json = json.NewEncoder(w)
+	}
+
+	return e
+}
+
+func (e *clickExporter) contentType() string {
+	if e.format == "csv" {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson; charset=utf-8"
+}
+
+func (e *clickExporter) add(click redisStorage.Click) {
+	if e.aggregate == "day" {
+		// Clicks are sorted by time, so a day is complete as soon as the next one starts
+		day := click.Timestamp.Format("2006-01-02")
+		if day != e.day {
+			e.writeDay()
+			e.day = day
+		}
+		e.dayClicks++
+		return
+	}
+
+	if e.csv != nil {
+		e.csv.Write([]string{click.Timestamp.Format(time.RFC3339Nano), e.shortUrl, click.RemoteIP, click.UserAgent, click.Referer, click.Variant})
+	} else {
+		e.json.Encode(struct {
+			Short string `json:"short"`
+			redisStorage.Click
+		}{e.shortUrl, click})
+	}
+}
+
+func (e *clickExporter) writeDay() {
+	if e.dayClicks == 0 {
+		return
+	}
+
+	if e.csv != nil {
+		e.csv.Write([]string{e.day, e.shortUrl, strconv.Itoa(e.dayClicks)})
+	} else {
+		e.json.Encode(map[string]interface{}{"date": e.day, "short": e.shortUrl, "clicks": e.dayClicks})
+	}
+	e.dayClicks = 0
+}
+
+// Writes the last (partial) aggregate
+func (e *clickExporter) finish() {
+	if e.aggregate == "day" {
+		e.writeDay()
+	}
+}
+
+// Sends what has been written so far to the client as a chunk
+func (e *clickExporter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
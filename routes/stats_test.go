@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// Creates a short url through the handler and returns the decoded response
+func shortenTestUrl(t *testing.T, post request) map[string]interface{} {
+	jsonBody, err := json.Marshal(post)
+	if err != nil {
+		t.Errorf("Error at creating json from struct: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "/short", strings.NewReader(string(jsonBody)))
+	if err != nil {
+		t.Errorf("Error at creating HTTP request: %v", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(ShortenUrl)
+	handler.ServeHTTP(recorder, req)
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var m map[string]interface{}
+	json.Unmarshal(recorder.Body.Bytes(), &m)
+	return m
+}
+
+func deleteTestLink(shortUrl string) {
+	// Short urls of a workspace are stored in its namespace
+	if key, err := redisStorage.ResolveKey(redisStorage.Ctx, shortUrl); err == nil {
+		redisStorage.DeleteLink(redisStorage.Ctx, key)
+	}
+	redisStorage.DeleteLink(redisStorage.Ctx, shortUrl)
+}
+
+func TestExportStats(t *testing.T) {
+	config.Read()
+
+	created := shortenTestUrl(t, request{Url: "http://www.testsite1.com", CustomShort: "export0"})
+	defer deleteTestLink("export0")
+	ownerToken := fmt.Sprintf("%v", created["owner_token"])
+
+	router := mux.NewRouter()
+	router.HandleFunc("/stats/{shortUrl}/export", ExportStats)
+	router.HandleFunc("/{shortUrl}", ResolveUrl)
+
+	clicks := 3
+	for i := 0; i < clicks; i++ {
+		req, _ := http.NewRequest("GET", "/export0", nil)
+		req.Header.Set("User-Agent", "test-agent")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// csv export, one header line and one line per click
+	req, _ := http.NewRequest("GET", "/stats/export0/export?format=csv", nil)
+	req.Header.Set("X-Owner-Token", ownerToken)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != clicks+1 {
+		t.Errorf("Error: Wrong number of csv lines: got %v want %v", len(lines), clicks+1)
+	}
+	if !strings.Contains(lines[len(lines)-1], "test-agent") {
+		t.Errorf("Error: csv line does not contain the user agent: %v", lines[len(lines)-1])
+	}
+
+	// Daily aggregate in json lines
+	req, _ = http.NewRequest("GET", "/stats/export0/export?format=jsonl&aggregate=day", nil)
+	req.Header.Set("X-Owner-Token", ownerToken)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var day map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &day)
+	if day["clicks"] != float64(clicks) {
+		t.Errorf("Error: Wrong number of daily clicks: got %v want %v", day["clicks"], clicks)
+	}
+}
+
+func TestExportStatsNotOwner(t *testing.T) {
+	config.Read()
+
+	shortenTestUrl(t, request{Url: "http://www.testsite1.com", CustomShort: "export1"})
+	defer deleteTestLink("export1")
+
+	req, _ := http.NewRequest("GET", "/stats/export1/export", nil)
+	req.Header.Set("X-Owner-Token", "wrong-token")
+	rr := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/stats/{shortUrl}/export", ExportStats)
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	bodyBytes, _ := io.ReadAll(rr.Body)
+	if strings.Contains(string(bodyBytes), "remote_ip") {
+		t.Errorf("Error: clicks exported without the owner token")
+	}
+}
@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/redisStorage"
+
+	"fmt"
+	"net/url"
+)
+
+// Returns the UTM parameters of a new short url: those of the named workspace template,
+// overridden by the fields of the utm object of the request
+func requestUTM(body *request, workspace redisStorage.Workspace) (redisStorage.UTM, error) {
+	var utm redisStorage.UTM
+
+	if body.UTMTemplate != "" {
+		template, ok := workspace.UTMTemplates[body.UTMTemplate]
+		if !ok {
+			return utm, fmt.Errorf("unknown utm template %s", body.UTMTemplate)
+		}
+		utm = template
+	}
+
+	if body.UTM != nil {
+		if body.UTM.Source != "" {
+			utm.Source = body.UTM.Source
+		}
+		if body.UTM.Medium != "" {
+			utm.Medium = body.UTM.Medium
+		}
+		if body.UTM.Campaign != "" {
+			utm.Campaign = body.UTM.Campaign
+		}
+		if body.UTM.Term != "" {
+			utm.Term = body.UTM.Term
+		}
+		if body.UTM.Content != "" {
+			utm.Content = body.UTM.Content
+		}
+	}
+
+	return utm, nil
+}
+
+// Adds the UTM parameters to a url. The parameters of the url are kept as they are, and those
+// that already have another value are returned as conflicts instead of being overwritten.
+func applyUTM(longUrl string, utm redisStorage.UTM) (string, []string, error) {
+	if utm == (redisStorage.UTM{}) {
+		return longUrl, nil, nil
+	}
+
+	u, err := url.Parse(longUrl)
+	if err != nil {
+		return "", nil, err
+	}
+	existing := u.Query()
+
+	var conflicts []string
+	added := url.Values{}
+	for _, param := range []struct {
+		name  string
+		value string
+	}{
+		{"utm_source", utm.Source},
+		{"utm_medium", utm.Medium},
+		{"utm_campaign", utm.Campaign},
+		{"utm_term", utm.Term},
+		{"utm_content", utm.Content},
+	} {
+		if param.value == "" {
+			continue
+		}
+		values, ok := existing[param.name]
+		if !ok {
+			added.Set(param.name, param.value)
+		} else if len(values) != 1 || values[0] != param.value {
+			conflicts = append(conflicts, param.name)
+		}
+	}
+	if len(conflicts) > 0 || len(added) == 0 {
+		return longUrl, conflicts, nil
+	}
+
+	// Appended, so the order and encoding of the existing parameters don't change
+	u.RawQuery = appendQuery(u.RawQuery, added)
+
+	return u.String(), nil, nil
+}
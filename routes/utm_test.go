@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestApplyUTM(t *testing.T) {
+	utm := redisStorage.UTM{Source: "newsletter", Medium: "email"}
+
+	tests := []struct {
+		url       string
+		want      string
+		conflicts []string
+	}{
+		{"https://www.testsite1.com", "https://www.testsite1.com?utm_medium=email&utm_source=newsletter", nil},
+		{"https://www.testsite1.com/p?b=2&a=1", "https://www.testsite1.com/p?b=2&a=1&utm_medium=email&utm_source=newsletter", nil},
+		{"https://www.testsite1.com/p?utm_source=newsletter", "https://www.testsite1.com/p?utm_source=newsletter&utm_medium=email", nil},
+		{"https://www.testsite1.com/p?utm_source=ads&utm_medium=cpc", "https://www.testsite1.com/p?utm_source=ads&utm_medium=cpc", []string{"utm_source", "utm_medium"}},
+	}
+	for _, test := range tests {
+		got, conflicts, err := applyUTM(test.url, utm)
+		if err != nil || got != test.want {
+			t.Errorf("Error: Wrong url: got %q want %q (%v)", got, test.want, err)
+		}
+		if strings.Join(conflicts, ",") != strings.Join(test.conflicts, ",") {
+			t.Errorf("Error: Wrong conflicts: got %v want %v", conflicts, test.conflicts)
+		}
+	}
+}
+
+func TestUTMTemplate(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("utm0")
+
+	ws := createTestWorkspace(t, handler, `,"utm_templates":{"spring":{"source":"newsletter","medium":"email","campaign":"spring-sale"}}`)
+	key, _ := issueTestAPIKey(t, handler, fmt.Sprintf(`{"name":"marketing","scopes":["create"],"workspace":"%s"}`, ws))
+	headers := map[string]string{"X-API-Key": key}
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"https://www.testsite1.com","utm_template":"summer"}`, headers)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"https://www.testsite1.com?utm_campaign=winter","utm_template":"spring"}`, headers)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "utm_campaign") {
+		t.Errorf("Error: Expected a utm_campaign conflict, got %v %q", rr.Code, rr.Body.String())
+	}
+
+	// The fields of the utm object override the template
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"https://www.testsite1.com/?ref=1","short":"utm0","utm_template":"spring","utm":{"content":"banner","medium":"social"}}`, headers)
+	var created response
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	want := "https://www.testsite1.com/?ref=1&utm_campaign=spring-sale&utm_content=banner&utm_medium=social&utm_source=newsletter"
+	if rr.Code != http.StatusOK || created.Url != want {
+		t.Errorf("Error: Wrong url: got %v %q want %q", rr.Code, created.Url, want)
+	}
+}
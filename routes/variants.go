@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"go.uber.org/zap"
+)
+
+const (
+	maxVariants = 10
+	// Weights are capped, so their total can't overflow
+	maxVariantWeight = 1000000
+
+	// Remembers the variant of a client, one cookie per short url
+	variantCookie = "variant"
+)
+
+var variantName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// Checks the variants of a short url. Variants without a name are named by their position: a, b, c...
+// On failure the error response is written and false is returned.
+func validateVariants(w http.ResponseWriter, r *http.Request, variants []redisStorage.Variant, workspace redisStorage.Workspace) bool {
+	if len(variants) == 0 {
+		return true
+	}
+	if len(variants) < 2 || len(variants) > maxVariants {
+		jsonError(w, r, http.StatusBadRequest, fmt.Sprintf("short urls have from 2 to %d variants", maxVariants))
+		return false
+	}
+
+	names := map[string]bool{}
+	for i := range variants {
+		variant := &variants[i]
+		if variant.Name == "" {
+			variant.Name = string(rune('a' + i))
+		}
+		if !variantName.MatchString(variant.Name) {
+			jsonError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid variant name %q, use up to 32 letters, digits, - or _", variant.Name))
+			return false
+		}
+		if names[variant.Name] {
+			jsonError(w, r, http.StatusBadRequest, fmt.Sprintf("variant %s is used more than once", variant.Name))
+			return false
+		}
+		names[variant.Name] = true
+
+		if variant.Weight <= 0 || variant.Weight > maxVariantWeight {
+			jsonError(w, r, http.StatusBadRequest, fmt.Sprintf("the weight of variant %s must be from 1 to %d", variant.Name, maxVariantWeight))
+			return false
+		}
+		if !validateUrl(w, r, variant.Url, workspace) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the variant of a short url for the client. Clients keep the variant of their cookie,
+// new clients get one at random by the weights of the variants and the cookie to keep it.
+func pickVariant(w http.ResponseWriter, r *http.Request, shortUrl string, link redisStorage.Link) (redisStorage.Variant, bool) {
+	if len(link.Variants) == 0 {
+		return redisStorage.Variant{}, false
+	}
+
+	// Variants removed since the cookie was set are picked again
+	if cookie, err := r.Cookie(variantCookie); err == nil {
+		for _, variant := range link.Variants {
+			if variant.Name == cookie.Value {
+				return variant, true
+			}
+		}
+	}
+
+	variant := weightedVariant(r, link.Variants)
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookie,
+		Value:    variant.Name,
+		Path:     "/" + url.PathEscape(shortUrl),
+		MaxAge:   int(linkExpiry(link).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return variant, true
+}
+
+// Picks a variant at random, each with the probability of its share of the total weight
+func weightedVariant(r *http.Request, variants []redisStorage.Variant) redisStorage.Variant {
+	var total int64
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(total))
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Could not pick a variant", zap.Error(err))
+		return variants[0]
+	}
+
+	pick := n.Int64()
+	for _, variant := range variants {
+		if pick < variant.Weight {
+			return variant
+		}
+		pick -= variant.Weight
+	}
+	return variants[len(variants)-1]
+}
@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWeightedVariant(t *testing.T) {
+	variants := []redisStorage.Variant{{Name: "a", Weight: 70}, {Name: "b", Weight: 30}}
+	req, _ := http.NewRequest("GET", "/", nil)
+
+	picked := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		picked[weightedVariant(req, variants).Name]++
+	}
+	// 1400 expected, far enough from it to never fail by chance
+	if picked["a"] < 1250 || picked["a"] > 1550 {
+		t.Errorf("Error: Wrong share of variant a: got %v of 2000", picked["a"])
+	}
+}
+
+func TestVariants(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("variant0")
+
+	invalid := []string{
+		`{"url":"http://www.testsite1.com","short":"variant0","variants":[{"url":"http://www.testsite2.com","weight":1}]}`,
+		`{"url":"http://www.testsite1.com","short":"variant0","variants":[{"url":"http://www.testsite2.com","weight":1},{"url":"http://www.testsite3.com","weight":0}]}`,
+		`{"url":"http://www.testsite1.com","short":"variant0","variants":[{"url":"http://www.testsite2.com","weight":9223372036854775807},{"url":"http://www.testsite3.com","weight":9223372036854775807}]}`,
+		`{"url":"http://www.testsite1.com","short":"variant0","variants":[{"name":"x","url":"http://www.testsite2.com","weight":1},{"name":"x","url":"http://www.testsite3.com","weight":1}]}`,
+	}
+	for _, body := range invalid {
+		rr := serveTestRequest(handler, "POST", "/short", body, nil)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Error: Handler returned wrong status code for %s: got %v want %v", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"variant0","variants":[{"url":"http://www.testsite2.com","weight":70},{"url":"http://www.testsite3.com","weight":30}]}`, nil)
+	var created response
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if rr.Code != http.StatusOK || len(created.Variants) != 2 || created.Variants[0].Name != "a" || created.Variants[1].Name != "b" {
+		t.Fatalf("Error: Short url with variants not created: %v %s", rr.Code, rr.Body.String())
+	}
+	destinations := map[string]string{"a": "http://www.testsite2.com", "b": "http://www.testsite3.com"}
+
+	click := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		var headers map[string]string
+		if cookie != nil {
+			headers = map[string]string{"Cookie": cookie.String()}
+		}
+		return clickTestUrl(handler, "variant0", randomTestIP()+":41234", headers)
+	}
+
+	// New visitors get a variant and a cookie to keep it
+	rr = click(nil)
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != variantCookie || cookies[0].Path != "/variant0" {
+		t.Fatalf("Error: Expected the variant cookie, got %v", cookies)
+	}
+	variant := cookies[0].Value
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != destinations[variant] {
+		t.Errorf("Error: Wrong redirect for variant %s: got %v %q", variant, rr.Code, rr.Header().Get("Location"))
+	}
+	for i := 0; i < 3; i++ {
+		rr = click(cookies[0])
+		if rr.Header().Get("Location") != destinations[variant] || len(rr.Result().Cookies()) != 0 {
+			t.Errorf("Error: Sticky variant %s not kept: got %q", variant, rr.Header().Get("Location"))
+		}
+	}
+
+	// Cookies of other short urls or removed variants get a new one
+	rr = click(&http.Cookie{Name: variantCookie, Value: "removed"})
+	if len(rr.Result().Cookies()) != 1 {
+		t.Errorf("Error: Expected a new variant cookie")
+	}
+
+	rr = serveTestRequest(handler, "GET", "/stats/variant0", "", map[string]string{"X-Owner-Token": created.OwnerToken})
+	var stats statsResponse
+	json.Unmarshal(rr.Body.Bytes(), &stats)
+	if rr.Code != http.StatusOK || len(stats.Variants) != 2 {
+		t.Fatalf("Error: Wrong stats: %v %s", rr.Code, rr.Body.String())
+	}
+	var total int64
+	for _, v := range stats.Variants {
+		total += v.Clicks
+		if v.Name == variant && v.Clicks < 4 {
+			t.Errorf("Error: Wrong clicks of variant %s: got %v want at least 4", v.Name, v.Clicks)
+		}
+	}
+	if total != 5 {
+		t.Errorf("Error: Wrong total clicks of the variants: got %v want 5", total)
+	}
+
+	rr = serveTestRequest(handler, "GET", "/stats/variant0", "", map[string]string{"X-Owner-Token": "wrong-token"})
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	// The export has the variant of every click
+	rr = serveTestRequest(handler, "GET", "/stats/variant0/export?format=csv", "", map[string]string{"X-Owner-Token": created.OwnerToken})
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if !strings.HasSuffix(lines[0], ",variant") || !strings.HasSuffix(lines[1], ","+variant) {
+		t.Errorf("Error: Variants not exported: %q", rr.Body.String())
+	}
+
+	// Removing the variants makes the short url redirect to its url again
+	serveTestRequest(handler, "PATCH", "/short/variant0", `{"variants":[]}`, map[string]string{"X-Owner-Token": created.OwnerToken})
+	rr = click(cookies[0])
+	if rr.Code != http.StatusPermanentRedirect || rr.Header().Get("Location") != "http://www.testsite1.com" {
+		t.Errorf("Error: Wrong redirect: got %v %q", rr.Code, rr.Header().Get("Location"))
+	}
+}
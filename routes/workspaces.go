@@ -0,0 +1,276 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/auth"
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Workspace ids are also used in the claims of users, so they are readable slugs
+var workspaceID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Fields of a workspace, missing fields are not changed when a workspace is updated
+type workspaceRequest struct {
+	ID             string    `json:"id"` // Only used when the workspace is created
+	Name           *string   `json:"name"`
+	DefaultExpiry  *int64    `json:"default_expiry_seconds"`
+	AllowedDomains *[]string `json:"allowed_domains"`
+	MaxLinks       *int64    `json:"max_links"`
+	MaxLinksPerDay *int64    `json:"max_links_per_day"`
+
+	UTMTemplates *map[string]redisStorage.UTM `json:"utm_templates"`
+}
+
+// Applies the fields of the request to the workspace, returning a message for invalid fields
+func (body *workspaceRequest) apply(ws *redisStorage.Workspace) string {
+	if body.Name != nil {
+		if *body.Name == "" {
+			return "name can't be empty"
+		}
+		ws.Name = *body.Name
+	}
+	if body.DefaultExpiry != nil {
+		if *body.DefaultExpiry < 0 {
+			return "default_expiry_seconds can't be negative"
+		}
+		ws.DefaultExpiry = *body.DefaultExpiry
+	}
+	if body.AllowedDomains != nil {
+		ws.AllowedDomains = *body.AllowedDomains
+	}
+	if body.MaxLinks != nil {
+		if *body.MaxLinks < 0 {
+			return "max_links can't be negative"
+		}
+		ws.MaxLinks = *body.MaxLinks
+	}
+	if body.MaxLinksPerDay != nil {
+		if *body.MaxLinksPerDay < 0 {
+			return "max_links_per_day can't be negative"
+		}
+		ws.MaxLinksPerDay = *body.MaxLinksPerDay
+	}
+	if body.UTMTemplates != nil {
+		for name, utm := range *body.UTMTemplates {
+			if name == "" || utm == (redisStorage.UTM{}) {
+				return "utm templates need a name and at least one parameter"
+			}
+		}
+		ws.UTMTemplates = *body.UTMTemplates
+	}
+
+	return ""
+}
+
+// Creates a workspace, only global admins can do it
+func CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	body := new(workspaceRequest)
+	if !decodeJSON(w, r, body) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if !auth.FromContext(r.Context()).IsGlobalAdmin() {
+		jsonError(w, r, http.StatusForbidden, "only global admins can manage workspaces")
+		return
+	}
+
+	if !workspaceID.MatchString(body.ID) {
+		jsonError(w, r, http.StatusBadRequest, "id must contain only lowercase letters, digits and dashes")
+		return
+	}
+	if body.Name == nil {
+		body.Name = &body.ID
+	}
+
+	_, found, err := redisStorage.GetWorkspace(r.Context(), body.ID)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+	if found {
+		jsonError(w, r, http.StatusConflict, fmt.Sprintf("workspace %s already exists", body.ID))
+		return
+	}
+
+	ws := redisStorage.Workspace{
+		ID:        body.ID,
+		CreatedAt: time.Now().UTC(),
+	}
+	if msg := body.apply(&ws); msg != "" {
+		jsonError(w, r, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := redisStorage.SaveWorkspace(r.Context(), ws); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(ws); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "encoding response to json")
+		return
+	}
+
+	return
+}
+
+// Lists the workspaces that the admin can see, all of them for global admins
+func ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	workspaces, err := redisStorage.ListWorkspaces(r.Context())
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	principal := auth.FromContext(r.Context())
+	visible := make([]redisStorage.Workspace, 0, len(workspaces))
+	for _, ws := range workspaces {
+		if principal.AdminOf(ws.ID) {
+			visible = append(visible, ws)
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(visible); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "encoding response to json")
+		return
+	}
+
+	return
+}
+
+// Returns the settings of a workspace to its admins
+func GetWorkspace(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	ws, ok := administeredWorkspace(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(ws); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "encoding response to json")
+		return
+	}
+
+	return
+}
+
+// Updates the settings of a workspace, only global admins can do it.
+// Short urls that already exist keep their expiry until they are used again.
+func UpdateWorkspace(w http.ResponseWriter, r *http.Request) {
+	body := new(workspaceRequest)
+	if !decodeJSON(w, r, body) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	if !auth.FromContext(r.Context()).IsGlobalAdmin() {
+		jsonError(w, r, http.StatusForbidden, "only global admins can manage workspaces")
+		return
+	}
+
+	ws, ok := administeredWorkspace(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if msg := body.apply(&ws); msg != "" {
+		jsonError(w, r, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := redisStorage.SaveWorkspace(r.Context(), ws); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(ws); err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "encoding response to json")
+		return
+	}
+
+	return
+}
+
+// Loads a workspace that the client administers. Other workspaces are reported as missing.
+// On failure the error response is written and false is returned.
+func administeredWorkspace(w http.ResponseWriter, r *http.Request, id string) (redisStorage.Workspace, bool) {
+	ws, found, err := redisStorage.GetWorkspace(r.Context(), id)
+	if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return ws, false
+	}
+	if !found || !auth.FromContext(r.Context()).AdminOf(id) {
+		jsonError(w, r, http.StatusNotFound, "workspace not found")
+		return ws, false
+	}
+
+	return ws, true
+}
+
+// Returns the workspace of the authenticated client, the zero Workspace for clients outside workspaces.
+// On failure the error response is written and false is returned.
+func requestWorkspace(w http.ResponseWriter, r *http.Request) (redisStorage.Workspace, bool) {
+	principal := auth.FromContext(r.Context())
+	if principal == nil || principal.Workspace == "" {
+		return redisStorage.Workspace{}, true
+	}
+
+	ws, err := loadWorkspace(r.Context(), principal.Workspace)
+	if err == errWorkspaceNotFound {
+		jsonError(w, r, http.StatusForbidden, fmt.Sprintf("workspace %s does not exist", principal.Workspace))
+		return ws, false
+	} else if err != nil {
+		jsonError(w, r, http.StatusInternalServerError, "conntecting to redis")
+		return ws, false
+	}
+
+	return ws, true
+}
+
+var errWorkspaceNotFound = errors.New("workspace not found")
+
+// Returns the workspace with the given id, the zero Workspace for an empty id
+func loadWorkspace(ctx context.Context, id string) (redisStorage.Workspace, error) {
+	if id == "" {
+		return redisStorage.Workspace{}, nil
+	}
+
+	ws, found, err := redisStorage.GetWorkspace(ctx, id)
+	if err != nil {
+		return ws, err
+	}
+	if !found {
+		return ws, errWorkspaceNotFound
+	}
+
+	return ws, nil
+}
+
+// Returns the ttl of a short url, that is reset every time it is used.
+// Like at creation, short urls that go live later must not expire before they are used.
+func linkExpiry(link redisStorage.Link) time.Duration {
+	expiry := config.Get().Redis.Expiry
+	if link.Expiry > 0 {
+		expiry = link.Expiry
+	}
+	if link.ActiveFrom != nil && link.ActiveFrom.After(time.Now()) {
+		expiry += time.Until(*link.ActiveFrom)
+	}
+	return expiry
+}
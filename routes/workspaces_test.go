@@ -0,0 +1,206 @@
+package routes
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// Creates a workspace with the admin key of the test configuration and returns its id
+func createTestWorkspace(t *testing.T, handler http.Handler, settings string) string {
+	conf := config.Get()
+
+	id := "test-" + uuid.New().String()[:8]
+	body := fmt.Sprintf(`{"id":"%s"%s}`, id, settings)
+	rr := serveTestRequest(handler, "POST", "/admin/workspaces", body, map[string]string{"X-API-Key": conf.Auth.AdminKey})
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+
+	return id
+}
+
+func TestWorkspaceIsolation(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("ws0")
+
+	wsA := createTestWorkspace(t, handler, "")
+	wsB := createTestWorkspace(t, handler, "")
+	keyA, _ := issueTestAPIKey(t, handler, fmt.Sprintf(`{"name":"a","scopes":["create","read-info","manage"],"workspace":"%s"}`, wsA))
+	keyB, _ := issueTestAPIKey(t, handler, fmt.Sprintf(`{"name":"b","scopes":["create","read-info","manage"],"workspace":"%s"}`, wsB))
+	adminB, _ := issueTestAPIKey(t, handler, fmt.Sprintf(`{"name":"b-admin","scopes":["admin"],"workspace":"%s"}`, wsB))
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"ws0"}`, map[string]string{"X-API-Key": keyA})
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = serveTestRequest(handler, "GET", "/info/ws0", "", map[string]string{"X-API-Key": keyA})
+	var m map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &m)
+	if m["workspace"] != wsA {
+		t.Errorf("Error: Wrong workspace: got %v want %v", m["workspace"], wsA)
+	}
+
+	// Other workspaces, even their admins, can't see or manage the short url
+	for _, key := range []string{keyB, adminB} {
+		headers := map[string]string{"X-API-Key": key}
+		requests := []struct{ method, path, body string }{
+			{"GET", "/info/ws0", ""},
+			{"PATCH", "/short/ws0", `{"url":"http://www.testsite2.com"}`},
+			{"GET", "/stats/ws0/export", ""},
+			{"DELETE", "/short/ws0", ""},
+		}
+		for _, req := range requests {
+			rr = serveTestRequest(handler, req.method, req.path, req.body, headers)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("Error: %s %s returned wrong status code: got %v want %v", req.method, req.path, rr.Code, http.StatusBadRequest)
+			}
+		}
+	}
+
+	// Anonymous clients can't see it either, but it still resolves
+	rr = serveTestRequest(handler, "GET", "/info/ws0", "", nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	rr = serveTestRequest(handler, "GET", "/ws0", "", nil)
+	if rr.Code != http.StatusPermanentRedirect {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusPermanentRedirect)
+	}
+
+	// Workspace admins can't issue api keys for other workspaces
+	rr = serveTestRequest(handler, "POST", "/admin/keys", fmt.Sprintf(`{"name":"c","scopes":["create"],"workspace":"%s"}`, wsA),
+		map[string]string{"X-API-Key": adminB})
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+}
+
+func TestWorkspaceNamespace(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("ws1")
+
+	wsA := createTestWorkspace(t, handler, "")
+	wsB := createTestWorkspace(t, handler, "")
+	keyA, _ := issueTestAPIKey(t, handler, fmt.Sprintf(`{"name":"a","scopes":["create","read-info","manage"],"workspace":"%s"}`, wsA))
+	keyB, _ := issueTestAPIKey(t, handler, fmt.Sprintf(`{"name":"b","scopes":["create","read-info","manage"],"workspace":"%s"}`, wsB))
+
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com/private","short":"ws1"}`, map[string]string{"X-API-Key": keyA})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// The short url is stored in the namespace of the workspace
+	redisClient := redisStorage.Get()
+	if n, _ := redisClient.Exists(redisStorage.Ctx, "ws1", "link:ws1").Result(); n != 0 {
+		t.Errorf("Error: Short url of a workspace stored without its namespace")
+	}
+	if n, _ := redisClient.Exists(redisStorage.Ctx, "workspace:"+wsA+":ws1", "workspace:"+wsA+":link:ws1").Result(); n != 2 {
+		t.Errorf("Error: Short url not stored in the namespace of its workspace: got %v keys want 2", n)
+	}
+
+	// Names are unique across workspaces, without disclosing the url of the other short url
+	for _, headers := range []map[string]string{{"X-API-Key": keyB}, nil} {
+		rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite2.com","short":"ws1"}`, headers)
+		if rr.Code != http.StatusBadRequest || strings.Contains(rr.Body.String(), "testsite1") {
+			t.Errorf("Error: Wrong response for a taken short url: got %v %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	rr = serveTestRequest(handler, "GET", "/ws1", "", nil)
+	if rr.Code != http.StatusPermanentRedirect || rr.Header().Get("Location") != "http://www.testsite1.com/private" {
+		t.Errorf("Error: Wrong redirect: got %v %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	rr = serveTestRequest(handler, "DELETE", "/short/ws1", "", map[string]string{"X-API-Key": keyA})
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	// Once deleted, other workspaces can use the name
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite2.com","short":"ws1"}`, map[string]string{"X-API-Key": keyB})
+	if rr.Code != http.StatusOK {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// Colons would make keys of other namespaces
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite2.com","short":"link:ws1"}`, nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// Short urls of a workspace share its namespace with nothing else, like the keys of its quota
+func TestWorkspaceQuotaNamespace(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("links")
+	defer deleteTestLink("ws3")
+
+	ws := createTestWorkspace(t, handler, `,"max_links":10`)
+	key, _ := issueTestAPIKey(t, handler, fmt.Sprintf(`{"name":"a","scopes":["create","read-info","manage"],"workspace":"%s"}`, ws))
+	headers := map[string]string{"X-API-Key": key}
+
+	for _, short := range []string{"links", "ws3"} {
+		rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"`+short+`"}`, headers)
+		if rr.Code != http.StatusOK {
+			t.Errorf("Error: Handler returned wrong status code for %s: got %v want %v", short, rr.Code, http.StatusOK)
+		}
+		rr = serveTestRequest(handler, "GET", "/"+short, "", nil)
+		if rr.Code != http.StatusPermanentRedirect {
+			t.Errorf("Error: Handler returned wrong status code for %s: got %v want %v", short, rr.Code, http.StatusPermanentRedirect)
+		}
+	}
+
+	rr := serveTestRequest(handler, "GET", "/quota", "", headers)
+	var resp quotaResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || len(resp.Quotas) != 2 || resp.Quotas[1].ActiveLinks != 2 {
+		t.Errorf("Error: Wrong quota usage: got %v %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestWorkspaceSettings(t *testing.T) {
+	logger.New()
+	config.Read()
+	handler := New().Handler
+	defer deleteTestLink("ws1")
+
+	ws := createTestWorkspace(t, handler, `,"default_expiry_seconds":3600,"allowed_domains":["testsite1.com"],"max_links":1`)
+	key, _ := issueTestAPIKey(t, handler, fmt.Sprintf(`{"name":"a","scopes":["create"],"workspace":"%s"}`, ws))
+	headers := map[string]string{"X-API-Key": key}
+
+	// Only allowed domains can be shortened
+	rr := serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite2.com"}`, headers)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	// Short urls get the default expiry of the workspace
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://www.testsite1.com","short":"ws1"}`, headers)
+	var m map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &m)
+	if m["expires_in_seconds"] != float64(3600) {
+		t.Errorf("Returned wrong expiration time: got %v want %v", m["expires_in_seconds"], 3600)
+	}
+
+	// The workspace can't have more short urls than max_links
+	rr = serveTestRequest(handler, "POST", "/short", `{"url":"http://docs.testsite1.com"}`, headers)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Error: Handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,170 @@
+package scanner
+
+import (
+	"ilmavridis/url-shortener/config"
+	"ilmavridis/url-shortener/helpers"
+
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+func init() {
+	Register("hashlist", NewHashPrefixChecker)
+}
+
+// Threat type of list entries that don't name one
+const defaultThreat = "MALICIOUS"
+
+// Length of the hash prefixes that urls are looked up by
+const hashPrefixLength = 4
+
+// HashPrefixChecker looks up urls in a local list of SHA256 hashes, so urls can be checked offline.
+// Like the clients of the Safe Browsing Update API, it looks up the prefixes of the hashes and
+// confirms a matching prefix against the full hashes, since many urls share a prefix.
+type HashPrefixChecker struct {
+	hashes map[string][]listedHash // Raw prefix to the full hashes with it
+}
+
+type listedHash struct {
+	hash   string // Raw full hash
+	threat string
+}
+
+func NewHashPrefixChecker(conf config.Config) (URLChecker, error) {
+	if conf.Scanner.HashList.File == "" {
+		return nil, errors.New("a hash list file is required")
+	}
+
+	f, err := os.Open(conf.Scanner.HashList.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseHashPrefixes(f)
+}
+
+// Parses a hash list: one hex SHA256 hash per line, optionally followed by its threat type.
+// Empty lines and text after # are ignored.
+func ParseHashPrefixes(r io.Reader) (*HashPrefixChecker, error) {
+	c := &HashPrefixChecker{hashes: map[string][]listedHash{}}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// Prefixes alone can't be confirmed, so they would flag every url that shares them
+		hash, err := hex.DecodeString(fields[0])
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("line %d: invalid SHA256 hash %q", line, fields[0])
+		}
+
+		threat := defaultThreat
+		if len(fields) > 1 {
+			threat = fields[1]
+		}
+		prefix := string(hash[:hashPrefixLength])
+		c.hashes[prefix] = append(c.hashes[prefix], listedHash{hash: string(hash), threat: threat})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *HashPrefixChecker) Check(ctx context.Context, urls []string) (map[string]string, error) {
+	flagged := map[string]string{}
+
+	for _, rawUrl := range urls {
+		for _, expression := range urlExpressions(rawUrl) {
+			hash := sha256.Sum256([]byte(expression))
+			if threat, ok := c.lookup(hash[:]); ok {
+				flagged[rawUrl] = threat
+				break
+			}
+		}
+	}
+
+	return flagged, nil
+}
+
+func (c *HashPrefixChecker) lookup(hash []byte) (string, bool) {
+	for _, listed := range c.hashes[string(hash[:hashPrefixLength])] {
+		if listed.hash == string(hash) {
+			return listed.threat, true
+		}
+	}
+	return "", false
+}
+
+// Returns the host suffix and path prefix expressions of a url that are looked up in hash lists,
+// e.g. a.b.c/1/2.html?p=1, a.b.c/1/2.html, a.b.c/, a.b.c/1/, b.c/1/2.html?p=1...
+func urlExpressions(rawUrl string) []string {
+	u, err := helpers.ParseURL(rawUrl)
+	if err != nil {
+		return nil
+	}
+
+	host := helpers.Hostname(u)
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		// At most four suffixes of the last five components, without the top level domain alone
+		components := strings.Split(host, ".")
+		first := len(components) - 5
+		if first < 1 {
+			first = 1
+		}
+		for i := first; i < len(components)-1; i++ {
+			hosts = append(hosts, strings.Join(components[i:], "."))
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	var paths []string
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+
+	// The root and at most three directories of the path
+	prefix := "/"
+	paths = append(paths, prefix)
+	directories := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i < len(directories)-1 && i < 3; i++ {
+		prefix += directories[i] + "/"
+		paths = append(paths, prefix)
+	}
+
+	seen := map[string]bool{}
+	var expressions []string
+	for _, h := range hosts {
+		for _, p := range paths {
+			expression := h + p
+			if !seen[expression] {
+				seen[expression] = true
+				expressions = append(expressions, expression)
+			}
+		}
+	}
+
+	return expressions
+}
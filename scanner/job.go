@@ -0,0 +1,123 @@
+package scanner
+
+import (
+	"ilmavridis/url-shortener/logger"
+	"ilmavridis/url-shortener/redisStorage"
+
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Short urls read from redis and checked at once
+const scanPageSize = 500
+
+// Scans the existing short urls every interval until the context is canceled.
+// Only one replica scans in every interval.
+func RunPeriodic(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		client, err := redisStorage.NewClient()
+		if err != nil {
+			logger.Error("Could not connect to redis to scan short urls: ", err)
+			continue
+		}
+
+		// Expires a bit before the next run, so a replica that missed it can take over
+		locked, err := redisStorage.TryLock(ctx, client, "scanner", interval-interval/10)
+		if err == nil && locked {
+			flagged, err := ScanLinks(ctx, client)
+			if err != nil {
+				logger.Error("Could not scan short urls: ", err)
+			}
+			logger.Info("Short urls scanned", zap.Int("flagged", flagged))
+		} else if err != nil {
+			logger.Error("Could not lock short url scanning: ", err)
+		}
+
+		client.Close()
+	}
+}
+
+// Checks all short urls, their other destinations and their fallback urls with the configured checker.
+// Short urls with a flagged url or destination are disabled and flagged fallback urls are removed.
+// It returns the number of flagged urls.
+func ScanLinks(ctx context.Context, client *redis.Client) (int, error) {
+	flagged := 0
+	var cursor uint64
+
+	for {
+		links, next, err := redisStorage.ScanLinks(ctx, client, cursor, scanPageSize)
+		if err != nil {
+			return flagged, err
+		}
+
+		if len(links) > 0 {
+			urls := make([]string, 0, len(links))
+			for _, link := range links {
+				if link.Url != "" {
+					urls = append(urls, link.Url)
+				}
+				urls = append(urls, link.Destinations...)
+				if link.FallbackUrl != "" {
+					urls = append(urls, link.FallbackUrl)
+				}
+			}
+
+			threats, err := Get().Check(ctx, urls)
+			if err != nil {
+				return flagged, err
+			}
+
+			for shortUrl, link := range links {
+				// Disabled short urls redirect to their fallback url, so it is removed first
+				if threat, ok := threats[link.FallbackUrl]; ok && link.FallbackUrl != "" {
+					if err := redisStorage.DeleteFallback(ctx, client, shortUrl); err != nil {
+						return flagged, err
+					}
+					logger.Info("Fallback url removed", zap.String("short", shortUrl), zap.String("threat", threat))
+					flagged++
+				}
+
+				if threat, ok := linkThreat(link, threats); ok {
+					if err := redisStorage.DisableLink(ctx, client, shortUrl, threat); err != nil {
+						return flagged, err
+					}
+					logger.Info("Short url disabled", zap.String("short", shortUrl), zap.String("threat", threat))
+					flagged++
+				}
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return flagged, nil
+		}
+	}
+}
+
+// Returns the threat of the url or of one of the other destinations of a short url, if any was flagged
+func linkThreat(link redisStorage.ScannedLink, threats map[string]string) (string, bool) {
+	if link.Url == "" {
+		return "", false
+	}
+	if threat, ok := threats[link.Url]; ok {
+		return threat, true
+	}
+	for _, destination := range link.Destinations {
+		if threat, ok := threats[destination]; ok {
+			return threat, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"ilmavridis/url-shortener/config"
+
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("safebrowsing", NewSafeBrowsingChecker)
+}
+
+// Maximum number of urls of a Lookup API request
+const safeBrowsingBatch = 500
+
+var safeBrowsingThreats = []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"}
+
+// SafeBrowsingChecker looks up urls with the Lookup API (threatMatches:find) of Google Safe Browsing v4
+// or of a compatible service
+type SafeBrowsingChecker struct {
+	endpoint string
+	apiKey   string
+	clientID string
+	client   *http.Client
+}
+
+func NewSafeBrowsingChecker(conf config.Config) (URLChecker, error) {
+	sb := conf.Scanner.SafeBrowsing
+	if sb.APIKey == "" {
+		return nil, errors.New("an api key is required")
+	}
+
+	return &SafeBrowsingChecker{
+		endpoint: strings.TrimSuffix(sb.Endpoint, "/"),
+		apiKey:   sb.APIKey,
+		clientID: sb.ClientID,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+type threatEntry struct {
+	URL string `json:"url"`
+}
+
+type threatMatchesRequest struct {
+	Client struct {
+		ClientID string `json:"clientId"`
+	} `json:"client"`
+	ThreatInfo struct {
+		ThreatTypes      []string      `json:"threatTypes"`
+		PlatformTypes    []string      `json:"platformTypes"`
+		ThreatEntryTypes []string      `json:"threatEntryTypes"`
+		ThreatEntries    []threatEntry `json:"threatEntries"`
+	} `json:"threatInfo"`
+}
+
+type threatMatchesResponse struct {
+	Matches []struct {
+		ThreatType string      `json:"threatType"`
+		Threat     threatEntry `json:"threat"`
+	} `json:"matches"`
+}
+
+func (c *SafeBrowsingChecker) Check(ctx context.Context, urls []string) (map[string]string, error) {
+	flagged := map[string]string{}
+
+	for start := 0; start < len(urls); start += safeBrowsingBatch {
+		end := start + safeBrowsingBatch
+		if end > len(urls) {
+			end = len(urls)
+		}
+		if err := c.find(ctx, urls[start:end], flagged); err != nil {
+			return nil, err
+		}
+	}
+
+	return flagged, nil
+}
+
+func (c *SafeBrowsingChecker) find(ctx context.Context, urls []string, flagged map[string]string) error {
+	var body threatMatchesRequest
+	body.Client.ClientID = c.clientID
+	body.ThreatInfo.ThreatTypes = safeBrowsingThreats
+	body.ThreatInfo.PlatformTypes = []string{"ANY_PLATFORM"}
+	body.ThreatInfo.ThreatEntryTypes = []string{"URL"}
+	for _, url := range urls {
+		body.ThreatInfo.ThreatEntries = append(body.ThreatInfo.ThreatEntries, threatEntry{URL: url})
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint+"/v4/threatMatches:find?key="+c.apiKey, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("safe browsing lookup: %s", resp.Status)
+	}
+
+	var matches threatMatchesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&matches); err != nil {
+		return err
+	}
+	for _, match := range matches.Matches {
+		flagged[match.Threat.URL] = match.ThreatType
+	}
+
+	return nil
+}
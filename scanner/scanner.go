@@ -0,0 +1,85 @@
+package scanner
+
+import (
+	"ilmavridis/url-shortener/config"
+
+	"context"
+	"fmt"
+	"sync"
+)
+
+// URLChecker looks up urls in a source of malicious urls.
+// Checkers for other sources implement it and register a Factory.
+type URLChecker interface {
+	// Returns the threat type (e.g. MALWARE) of every flagged url, safe urls are left out
+	Check(ctx context.Context, urls []string) (map[string]string, error)
+}
+
+// Factory creates a URLChecker from the service configuration
+type Factory func(conf config.Config) (URLChecker, error)
+
+var (
+	mu        sync.RWMutex
+	factories            = map[string]Factory{}
+	checker   URLChecker = multiChecker{}
+)
+
+// Register makes a checker available by name to the scanner.checkers configuration
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[name] = factory
+}
+
+// Init creates the checkers selected in the configuration.
+// If no checker is configured, every url is considered safe.
+func Init() error {
+	conf := config.Get()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	checkers := multiChecker{}
+	for _, name := range conf.Scanner.Checkers {
+		factory, ok := factories[name]
+		if !ok {
+			return fmt.Errorf("unknown url checker %q", name)
+		}
+
+		c, err := factory(conf)
+		if err != nil {
+			return fmt.Errorf("url checker %s: %v", name, err)
+		}
+		checkers = append(checkers, c)
+	}
+	checker = checkers
+
+	return nil
+}
+
+// Returns the checker created by Init
+func Get() URLChecker {
+	mu.RLock()
+	defer mu.RUnlock()
+	return checker
+}
+
+// multiChecker flags the urls flagged by any of its checkers
+type multiChecker []URLChecker
+
+func (checkers multiChecker) Check(ctx context.Context, urls []string) (map[string]string, error) {
+	flagged := map[string]string{}
+	for _, c := range checkers {
+		threats, err := c.Check(ctx, urls)
+		if err != nil {
+			return nil, err
+		}
+		for url, threat := range threats {
+			if _, ok := flagged[url]; !ok {
+				flagged[url] = threat
+			}
+		}
+	}
+
+	return flagged, nil
+}
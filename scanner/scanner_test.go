@@ -0,0 +1,137 @@
+package scanner
+
+import (
+	"ilmavridis/url-shortener/config"
+
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testHashPrefixes = `
+# SHA256 hashes of the scanner tests
+a3db7caf7791ae13903f7207dd97298f343f5887539453fbc5a9d61d4b8be7b3 MALWARE # malware.example.com/
+604c445e12e373bb2e430ff1983e6081bb749d929413fed58af7cb618e721d16         # phishing.example.org/login
+`
+
+func TestParseHashPrefixes(t *testing.T) {
+	if _, err := ParseHashPrefixes(strings.NewReader("a3db7caf MALWARE")); err == nil {
+		t.Errorf("Error: Expected an error for a hash prefix without its full hash")
+	}
+	if _, err := ParseHashPrefixes(strings.NewReader("not-hex MALWARE")); err == nil {
+		t.Errorf("Error: Expected an error for an invalid hash prefix")
+	}
+
+	checker, err := ParseHashPrefixes(strings.NewReader(testHashPrefixes))
+	if err != nil {
+		t.Fatalf("Error at parsing hash prefixes: %v", err)
+	}
+
+	tests := []struct {
+		url    string
+		threat string
+	}{
+		{"http://malware.example.com", "MALWARE"},
+		{"https://www.malware.example.com/download/file.exe?id=1", "MALWARE"},
+		{"http://phishing.example.org/login", defaultThreat},
+		{"http://phishing.example.org/login?next=/account", defaultThreat},
+		{"http://phishing.example.org/about", ""},
+		{"http://example.com", ""},
+	}
+
+	urls := make([]string, 0, len(tests))
+	for _, test := range tests {
+		urls = append(urls, test.url)
+	}
+	flagged, err := checker.Check(context.Background(), urls)
+	if err != nil {
+		t.Fatalf("Error at checking urls: %v", err)
+	}
+
+	for _, test := range tests {
+		if threat := flagged[test.url]; threat != test.threat {
+			t.Errorf("Error: Wrong threat for %s: got %q want %q", test.url, threat, test.threat)
+		}
+	}
+}
+
+func TestHashPrefixConfirmed(t *testing.T) {
+	// Same prefix as the hash of malware.example.com/, but another hash
+	checker, err := ParseHashPrefixes(strings.NewReader("a3db7caf00000000000000000000000000000000000000000000000000000000 MALWARE"))
+	if err != nil {
+		t.Fatalf("Error at parsing hash prefixes: %v", err)
+	}
+
+	flagged, err := checker.Check(context.Background(), []string{"http://malware.example.com"})
+	if err != nil {
+		t.Fatalf("Error at checking urls: %v", err)
+	}
+	if len(flagged) != 0 {
+		t.Errorf("Error: Url flagged by a hash prefix alone: %v", flagged)
+	}
+}
+
+func TestUrlExpressions(t *testing.T) {
+	expressions := urlExpressions("http://a.b.c/1/2.html?param=1")
+	want := []string{
+		"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+		"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+	}
+
+	if strings.Join(expressions, " ") != strings.Join(want, " ") {
+		t.Errorf("Error: Wrong url expressions: got %v want %v", expressions, want)
+	}
+}
+
+func TestSafeBrowsingChecker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v4/threatMatches:find" || r.URL.Query().Get("key") != "test-key" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		var body threatMatchesRequest
+		json.NewDecoder(r.Body).Decode(&body)
+
+		var resp threatMatchesResponse
+		for _, entry := range body.ThreatInfo.ThreatEntries {
+			if strings.Contains(entry.URL, "malware") {
+				resp.Matches = append(resp.Matches, struct {
+					ThreatType string      `json:"threatType"`
+					Threat     threatEntry `json:"threat"`
+				}{"MALWARE", entry})
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	var conf config.Config
+	if _, err := NewSafeBrowsingChecker(conf); err == nil {
+		t.Errorf("Error: Expected an error without an api key")
+	}
+
+	conf.Scanner.SafeBrowsing.APIKey = "test-key"
+	conf.Scanner.SafeBrowsing.Endpoint = server.URL
+	checker, err := NewSafeBrowsingChecker(conf)
+	if err != nil {
+		t.Fatalf("Error at creating safe browsing checker: %v", err)
+	}
+
+	flagged, err := checker.Check(context.Background(), []string{"http://malware.example.com", "http://www.testsite1.com"})
+	if err != nil {
+		t.Fatalf("Error at checking urls: %v", err)
+	}
+	if len(flagged) != 1 || flagged["http://malware.example.com"] != "MALWARE" {
+		t.Errorf("Error: Wrong flagged urls: got %v", flagged)
+	}
+
+	conf.Scanner.SafeBrowsing.APIKey = "wrong-key"
+	checker, _ = NewSafeBrowsingChecker(conf)
+	if _, err := checker.Check(context.Background(), []string{"http://www.testsite1.com"}); err == nil {
+		t.Errorf("Error: Expected an error for a failed lookup")
+	}
+}